@@ -3,42 +3,55 @@ package blockchain
 import (
 	"bytes"
 	"crypto/sha256"
-	"encoding/gob"
-	"log"
-	"time"
 )
 
-type Block struct {
-	Timestamp     int64
-	Transactions  []*Transaction
+// BlockHeader holds everything proof of work commits to. The transactions
+// are committed to through MerkleRoot, so headers can be stored, walked and
+// validated without loading block bodies.
+type BlockHeader struct {
+	Version       int
 	PrevBlockHash []byte
-	Hash          []byte
+	MerkleRoot    []byte
+	Timestamp     int64
+	Bits          uint32
 	Nonce         int
-	Difficulty    int
 }
 
+type Block struct {
+	BlockHeader
+	Hash         []byte
+	Transactions []*Transaction
+}
+
+// Hash returns the hash of the serialized header.
+func (h *BlockHeader) Hash() []byte {
+	hash := sha256.Sum256(h.Serialize())
+	return hash[:]
+}
+
+// HashTransactions returns the Merkle root of the block's transaction IDs.
 func (b *Block) HashTransactions() []byte {
 	var txHashes [][]byte
-	var txHash [32]byte
 
 	for _, tx := range b.Transactions {
 		txHashes = append(txHashes, tx.ID)
 	}
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
 
-	return txHash[:]
+	return merkleRoot(txHashes)
 }
 
-func NewBlock(transactions []*Transaction, prevBlockHash []byte, difficulty int) *Block {
+func NewBlock(transactions []*Transaction, prevBlockHash []byte, bits uint32, timestamp int64) *Block {
 	block := &Block{
-		Timestamp:     time.Now().Unix(),
-		Transactions:  transactions,
-		PrevBlockHash: prevBlockHash,
-		Hash:          []byte{},
-		Nonce:         0,
-		Difficulty:    difficulty,
+		BlockHeader: BlockHeader{
+			Version:       blockVersion,
+			PrevBlockHash: prevBlockHash,
+			Timestamp:     timestamp,
+			Bits:          bits,
+		},
+		Transactions: transactions,
 	}
-	pow := NewProofOfWork(block)
+	block.MerkleRoot = block.HashTransactions()
+	pow := NewProofOfWork(&block.BlockHeader)
 	nonce, hash := pow.Run()
 
 	block.Nonce = nonce
@@ -46,29 +59,50 @@ func NewBlock(transactions []*Transaction, prevBlockHash []byte, difficulty int)
 	return block
 }
 
-func NewGenesisBlock(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{}, startDifficulty)
+func NewGenesisBlock(coinbase *Transaction, bits uint32, timestamp int64) *Block {
+	return NewBlock([]*Transaction{coinbase}, []byte{}, bits, timestamp)
 }
 
-func (b *Block) Serialize() []byte {
-	var result bytes.Buffer
-	encoder := gob.NewEncoder(&result)
-
-	err := encoder.Encode(b)
-	if err != nil {
-		log.Panic(err)
+// clone returns a deep copy of the block, so the copy handed out can be
+// modified without touching the one in the block cache.
+func (b *Block) clone() *Block {
+	c := &Block{BlockHeader: *b.BlockHeader.clone(), Hash: bytes.Clone(b.Hash)}
+	c.Transactions = make([]*Transaction, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		c.Transactions[i] = tx.clone()
 	}
+	return c
+}
 
-	return result.Bytes()
+func (h *BlockHeader) clone() *BlockHeader {
+	c := *h
+	c.PrevBlockHash = bytes.Clone(h.PrevBlockHash)
+	c.MerkleRoot = bytes.Clone(h.MerkleRoot)
+	return &c
 }
-func DeserializeBlock(d []byte) *Block {
-	var block Block
-	decoder := gob.NewDecoder(bytes.NewReader(d))
 
-	err := decoder.Decode(&block)
-	if err != nil {
-		log.Panic(err)
-	}
+// Serialize returns the canonical encoding of the block: its header followed
+// by its body.
+func (b *Block) Serialize() []byte {
+	var e encoder
+	b.BlockHeader.encode(&e)
+	encodeBody(&e, b.Transactions)
+	return e.buf
+}
+
+// DeserializeBlock decodes a block produced by Serialize. Malformed input is
+// reported as ErrCorruptBlock.
+func DeserializeBlock(d []byte) (*Block, error) {
+	return decodeBlock(d)
+}
+
+// Serialize returns the canonical encoding of the header.
+func (h *BlockHeader) Serialize() []byte {
+	var e encoder
+	h.encode(&e)
+	return e.buf
+}
 
-	return &block
+func DeserializeHeader(d []byte) (*BlockHeader, error) {
+	return decodeHeader(d)
 }
@@ -1,353 +1,753 @@
 package blockchain
 
 import (
-	"encoding/hex"
+	"bytes"
+	"errors"
 	"fmt"
-	"log"
+	"math/big"
 	"os"
+	"sync"
+	"time"
 
-	"github.com/Triad-0112/BlockChain.git/utils"
-	"github.com/dgraph-io/badger/v3"
+	"github.com/Triad-0112/BlockChain.git/storage"
+	"github.com/Triad-0112/BlockChain.git/wallet"
 )
 
 const (
-	dbPath                       = "./tmp/blocks"
-	dbLastHashKey                = "lh"
-	genesisCoinbaseData          = "The Times 16/Oct/2025 Chancellor on brink of second bailout for banks"
-	difficultyAdjustmentInterval = 5
-	targetBlockTime              = 15
-	startDifficulty              = 18
+	dbLastHashKey       = "lh"
+	genesisCoinbaseData = "The Times 16/Oct/2025 Chancellor on brink of second bailout for banks"
+
+	// dbFormatKey holds the storage format version. Databases written before
+	// the canonical encoding have no such key and must be migrated.
+	dbFormatKey     = "fv"
+	dbFormatVersion = 5
+	// dbPrunedKey is present once block bodies have been pruned, so a
+	// missing body can be told apart from a corrupt database.
+	dbPrunedKey = "pr"
+
+	// Headers and bodies are stored separately, each keyed by a one-byte
+	// prefix followed by the block hash, so walking the chain by header never
+	// has to decode transactions.
+	headerKeyPrefix = 'h'
+	bodyKeyPrefix   = 'b'
+	// The cumulative work of the chain up to and including a block is stored
+	// next to it under chainWorkKeyPrefix.
+	chainWorkKeyPrefix = 'w'
 )
 
+// Blockchain is safe for concurrent use. Blocks are never modified once
+// stored, so readers only need a consistent tip: Iterator and HeaderIterator
+// snapshot it when created and keep walking that chain even if blocks are
+// connected meanwhile. Writers are serialized by writeMu, so the tip can't
+// move while a block is being validated against it.
 type Blockchain struct {
+	tipMu    sync.RWMutex
 	lastHash []byte
-	db       *badger.DB
+	writeMu  sync.Mutex
+	db       storage.Store
+	params   *Params
+	now      func() time.Time
+	prune    int
+
+	failPoint func(FailPoint) error
+	// legacyBlocks is how many blocks from genesis may be migrated ones. It
+	// is only set while reindexing.
+	legacyBlocks int
+
+	headerCache *lruCache[*BlockHeader]
+	heightCache *lruCache[int]
+	blockCache  *lruCache[*Block]
+	utxoCache   *utxoCache
+
+	mempoolMu sync.Mutex
+	mempool   map[string]*Transaction
+	subsMu    sync.Mutex
+	subs      map[*subscription]bool
+}
+
+// Config selects the network and storage used by a Blockchain. The zero value
+// is the main network stored under MainNetParams.DBPath.
+type Config struct {
+	Params *Params
+	// DBPath overrides Params.DBPath when set.
+	DBPath string
+	// InMemory keeps the whole chain in memory; nothing is written to disk.
+	InMemory bool
+	// Backend is the storage backend of a new chain: storage.Badger, the
+	// default, or storage.Bolt. Existing chains are opened with the backend
+	// they were created with.
+	Backend string
+	// Clock replaces time.Now when mining and validating block timestamps.
+	Clock func() time.Time
+	// Prune, when positive, deletes the bodies of all but the last Prune
+	// blocks. Headers and the UTXO set are kept, so the chain can still be
+	// validated and extended, but old transactions can no longer be read.
+	Prune int
+	// Cache sets the sizes of the in-memory caches.
+	Cache CacheSizes
+	// FailPoint, if set, is called at each FailPoint while writing to the
+	// database. Returning an error abandons the write there, as if the
+	// process had crashed, so tests can check what survives a crash.
+	FailPoint func(FailPoint) error
 }
 
-func NewBlockchain(address string) *Blockchain {
-	if DbExists() {
-		fmt.Println("Blockchain already exists.")
-		os.Exit(1)
+func newBlockchain(db storage.Store, lastHash []byte, cfg Config) *Blockchain {
+	return &Blockchain{
+		lastHash:    lastHash,
+		db:          db,
+		params:      cfg.params(),
+		now:         cfg.clock(),
+		prune:       cfg.Prune,
+		failPoint:   cfg.FailPoint,
+		headerCache: newLRUCache[*BlockHeader](cacheSize(cfg.Cache.Headers, defaultHeaderCacheSize)),
+		heightCache: newLRUCache[int](cacheSize(cfg.Cache.Headers, defaultHeaderCacheSize)),
+		blockCache:  newLRUCache[*Block](cacheSize(cfg.Cache.Blocks, defaultBlockCacheSize)),
+		utxoCache:   newUTXOCache(cacheSize(cfg.Cache.UTXOs, defaultUTXOCacheSize)),
 	}
-	var lastHash []byte
+}
 
-	opts := badger.DefaultOptions(dbPath)
-	opts.Logger = nil
-	db, err := badger.Open(opts)
-	if err != nil {
-		log.Panic(err)
+func (c Config) params() *Params {
+	if c.Params == nil {
+		return &MainNetParams
 	}
+	return c.Params
+}
 
-	err = db.Update(func(txn *badger.Txn) error {
-		if _, err := txn.Get([]byte(dbLastHashKey)); err == badger.ErrKeyNotFound {
-			fmt.Println("No existing blockchain found. Creating a new one...")
-			cbtx := NewCoinbaseTX(address, genesisCoinbaseData)
-			genesis := NewGenesisBlock(cbtx)
-			genesis.Difficulty = startDifficulty
+func (c Config) clock() func() time.Time {
+	if c.Clock == nil {
+		return time.Now
+	}
+	return c.Clock
+}
 
-			err = txn.Set(genesis.Hash, genesis.Serialize())
-			if err != nil {
-				return err
-			}
-			err = txn.Set([]byte(dbLastHashKey), genesis.Hash)
-			lastHash = genesis.Hash
-			return err
-		} else {
-			item, err := txn.Get([]byte(dbLastHashKey))
+func (c Config) dbPath() string {
+	if c.DBPath != "" {
+		return c.DBPath
+	}
+	return c.params().DBPath
+}
+
+func (c Config) openDB() (storage.Store, error) {
+	return c.openDBAt(c.dbPath())
+}
+
+func (c Config) openDBAt(path string) (storage.Store, error) {
+	if c.InMemory {
+		return storage.NewMemory(), nil
+	}
+	backend := storage.Detect(path)
+	if backend == "" {
+		backend = c.Backend
+	} else if c.Backend != "" && c.Backend != backend {
+		return nil, fmt.Errorf("the database at %s uses the %s backend, not %s", path, backend, c.Backend)
+	}
+	if backend == "" {
+		backend = storage.Badger
+	}
+	return storage.Open(backend, path)
+}
+
+func NewBlockchain(address string) (*Blockchain, error) {
+	return CreateBlockchain(address, Config{})
+}
+
+// CreateBlockchain creates a chain whose genesis block pays address. It fails
+// with ErrChainExists if cfg already points at a chain on disk. The database
+// is built in a temporary directory and only moved into place once the
+// genesis block is stored, so an interrupted run leaves nothing behind.
+func CreateBlockchain(address string, cfg Config) (*Blockchain, error) {
+	cbtx, err := NewCoinbaseTX(address, genesisCoinbaseData, cfg.params().Bech32HRP)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.InMemory && ChainExists(cfg) {
+		err := removeIncompleteDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	params := cfg.params()
+	fmt.Println("No existing blockchain found. Creating a new one...")
+	genesis := NewGenesisBlock(cbtx, params.GenesisBits, cfg.clock()().Unix())
+
+	writeGenesis := func(db storage.Store) error {
+		return db.Batch(func(b storage.Batch) error {
+			err := connectBlock(b, genesis, 0)
 			if err != nil {
 				return err
 			}
-			err = item.Value(func(val []byte) error {
-				lastHash = val
-				return nil
-			})
-			return err
+			return b.Put([]byte(dbFormatKey), []byte{dbFormatVersion})
+		})
+	}
+
+	var db storage.Store
+	if cfg.InMemory {
+		db, err = cfg.openDB()
+		if err != nil {
+			return nil, err
 		}
-	})
+		err = writeGenesis(db)
+	} else {
+		db, err = createDB(cfg, writeGenesis)
+	}
+	if err != nil {
+		if db != nil {
+			_ = db.Close()
+		}
+		return nil, err
+	}
+
+	return newBlockchain(db, genesis.Hash, cfg), nil
+}
 
+func OpenBlockchain() (*Blockchain, error) {
+	return LoadBlockchain(Config{})
+}
+
+// LoadBlockchain opens the chain cfg points at. It fails with
+// ErrChainNotFound if there is none and ErrNeedsMigration if it was written
+// in an older storage format.
+func LoadBlockchain(cfg Config) (*Blockchain, error) {
+	if cfg.InMemory || !ChainExists(cfg) {
+		return nil, ErrChainNotFound
+	}
+	db, err := cfg.openDB()
+	if err != nil {
+		return nil, err
+	}
+	version, err := formatVersion(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if version == dbFormatVersion {
+		reindexing, err := hasKey(db, dbReindexKey)
+		if err == nil && reindexing {
+			err = ErrReindexing
+		}
+		if err != nil {
+			_ = db.Close()
+			return nil, err
+		}
+	}
+	if version != dbFormatVersion {
+		// Databases that never got a tip have no format key either; they
+		// need re-creating, not migrating.
+		tip, err := readTip(db)
+		_ = db.Close()
+		if err == nil && tip == nil {
+			return nil, errNoTip
+		}
+		return nil, fmt.Errorf("%w: storage format %d, expected %d", ErrNeedsMigration, version, dbFormatVersion)
+	}
+	lastHash, err := checkConsistency(db)
 	if err != nil {
-		log.Panic(err)
+		_ = db.Close()
+		return nil, err
 	}
+	bc := newBlockchain(db, lastHash, cfg)
+	err = bc.pruneBlocks()
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return bc, nil
+}
+
+// formatVersion returns the storage format version of db, or 0 for legacy
+// gob-encoded databases.
+func formatVersion(db storage.Reader) (int, error) {
+	val, err := getKey(db, dbFormatKey)
+	if err != nil || len(val) != 1 {
+		return 0, err
+	}
+	return int(val[0]), nil
+}
+
+func (bc *Blockchain) Params() *Params {
+	return bc.params
+}
+
+// Tip returns the hash of the last block of the chain.
+func (bc *Blockchain) Tip() []byte {
+	bc.tipMu.RLock()
+	defer bc.tipMu.RUnlock()
+	return bc.lastHash
+}
+
+func headerKey(hash []byte) []byte {
+	return append([]byte{headerKeyPrefix}, hash...)
+}
+
+func bodyKey(hash []byte) []byte {
+	return append([]byte{bodyKeyPrefix}, hash...)
+}
 
-	return &Blockchain{lastHash, db}
+func chainWorkKey(hash []byte) []byte {
+	return append([]byte{chainWorkKeyPrefix}, hash...)
 }
 
-func OpenBlockchain() *Blockchain {
-	if !DbExists() {
-		fmt.Println("No existing blockchain found. Create one first with 'createblockchain'.")
-		os.Exit(1)
+// putBlock stores the header, body and cumulative chainwork of block under
+// its hash. The parent block must already be stored.
+func putBlock(b storage.Batch, block *Block) error {
+	err := b.Put(headerKey(block.Hash), block.BlockHeader.Serialize())
+	if err != nil {
+		return err
 	}
-	var lastHash []byte
-	opts := badger.DefaultOptions(dbPath)
-	opts.Logger = nil
-	db, err := badger.Open(opts)
+	err = b.Put(bodyKey(block.Hash), serializeBody(block.Transactions))
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	err = db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(dbLastHashKey))
+	return putChainWork(b, block)
+}
+
+// putChainWork stores the cumulative work of the chain ending at block. That
+// of its parent must already be stored.
+func putChainWork(b storage.Batch, block *Block) error {
+	work := CalcWork(block.Bits)
+	if len(block.PrevBlockHash) != 0 {
+		parentWork, err := getChainWork(b, block.PrevBlockHash)
 		if err != nil {
 			return err
 		}
-		lastHash, err = item.ValueCopy(nil)
+		work.Add(work, parentWork)
+	}
+	return b.Put(chainWorkKey(block.Hash), work.Bytes())
+}
+
+// connectBlock stores block, updates the UTXO set with it and makes it the
+// tip, all in one batch, so a crash leaves either everything or nothing
+// written. height is the number of blocks before it.
+func connectBlock(b storage.Batch, block *Block, height int) error {
+	err := putBlock(b, block)
+	if err != nil {
 		return err
-	})
+	}
+	err = connectUTXOs(b, block, height)
+	if err != nil {
+		return err
+	}
+	err = b.Put([]byte(dbUTXOTipKey), block.Hash)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
-	return &Blockchain{lastHash, db}
+	return b.Put([]byte(dbLastHashKey), block.Hash)
 }
 
-func (bc *Blockchain) Iterator() *BlockchainIterator {
-	return &BlockchainIterator{bc.lastHash, bc.db}
+func getChainWork(r storage.Reader, hash []byte) (*big.Int, error) {
+	val, err := r.Get(chainWorkKey(hash))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(val), nil
 }
 
-type BlockchainIterator struct {
-	currentHash []byte
-	db          *badger.DB
+func getHeader(r storage.Reader, hash []byte) (*BlockHeader, error) {
+	val, err := r.Get(headerKey(hash))
+	if err != nil {
+		return nil, err
+	}
+	return decodeHeader(val)
 }
 
-func (i *BlockchainIterator) Next() *Block {
-	var block *Block
-	if i.currentHash == nil {
-		return nil
+func getBlock(r storage.Reader, hash []byte) (*Block, error) {
+	header, err := getHeader(r, hash)
+	if err != nil {
+		return nil, err
 	}
-	err := i.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(i.currentHash)
-		if err == badger.ErrKeyNotFound {
-			return err
+	val, err := r.Get(bodyKey(hash))
+	if errors.Is(err, storage.ErrNotFound) {
+		if _, prunedErr := r.Get([]byte(dbPrunedKey)); prunedErr == nil {
+			return nil, fmt.Errorf("%w: transactions of block %x", ErrPruned, hash)
 		}
-		var encodedBlock []byte
-		err = item.Value(func(val []byte) error {
-			encodedBlock = val
+	}
+	if err != nil {
+		return nil, err
+	}
+	block := &Block{BlockHeader: *header, Hash: hash}
+	block.Transactions, err = deserializeBody(val)
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// readError describes a failure to read block hash while walking the chain.
+// Every block the tip links back to must be stored, so a missing one means
+// the database is corrupt.
+func readError(hash []byte, err error) error {
+	if errors.Is(err, ErrPruned) {
+		return err
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("%w: block %x is missing", ErrCorruptBlock, hash)
+	}
+	return fmt.Errorf("reading block %x: %w", hash, err)
+}
+
+// maxBatchWrites bounds the writes put in one batch by bulk deletions, which
+// can touch more keys than a backend accepts in a single transaction.
+const maxBatchWrites = 10000
+
+// deleteKeys deletes keys from db in batches of at most maxBatchWrites.
+func deleteKeys(db storage.Store, keys [][]byte) error {
+	for len(keys) > 0 {
+		n := min(len(keys), maxBatchWrites)
+		err := db.Batch(func(b storage.Batch) error {
+			for _, key := range keys[:n] {
+				if err := b.Delete(key); err != nil {
+					return err
+				}
+			}
 			return nil
 		})
 		if err != nil {
 			return err
 		}
-		block = DeserializeBlock(encodedBlock)
-		return nil
-	})
-	if err == badger.ErrKeyNotFound {
+		keys = keys[n:]
+	}
+	return nil
+}
+
+func (bc *Blockchain) Iterator() *BlockchainIterator {
+	return &BlockchainIterator{bc.Tip(), bc, nil}
+}
+
+type BlockchainIterator struct {
+	currentHash []byte
+	bc          *Blockchain
+	err         error
+}
+
+// Next returns a copy of the next block, or nil once the genesis block has
+// been returned or a block could not be read. Err tells the two apart.
+func (i *BlockchainIterator) Next() *Block {
+	if len(i.currentHash) == 0 || i.err != nil {
 		return nil
 	}
+	block, err := i.bc.getBlock(i.currentHash)
 	if err != nil {
-		log.Panic(err)
+		i.err = readError(i.currentHash, err)
+		return nil
 	}
 	i.currentHash = block.PrevBlockHash
-	return block
+	return block.clone()
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (i *BlockchainIterator) Err() error {
+	return i.err
+}
+
+// HeaderIterator walks block headers from the tip back to genesis without
+// loading block bodies.
+func (bc *Blockchain) HeaderIterator() *HeaderIterator {
+	return bc.headerIteratorAt(bc.Tip())
+}
+
+func (bc *Blockchain) headerIteratorAt(hash []byte) *HeaderIterator {
+	return &HeaderIterator{hash, bc, nil}
+}
+
+type HeaderIterator struct {
+	currentHash []byte
+	bc          *Blockchain
+	err         error
+}
+
+// Next returns a copy of the next header and its block hash, or nil once the
+// genesis header has been returned or a header could not be read. Err tells
+// the two apart.
+func (i *HeaderIterator) Next() (*BlockHeader, []byte) {
+	if len(i.currentHash) == 0 || i.err != nil {
+		return nil, nil
+	}
+	hash := i.currentHash
+	header, err := i.bc.getHeader(hash)
+	if err != nil {
+		i.err = readError(hash, err)
+		return nil, nil
+	}
+	i.currentHash = header.PrevBlockHash
+	return header.clone(), bytes.Clone(hash)
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (i *HeaderIterator) Err() error {
+	return i.err
 }
 
+// CloseDB writes out the UTXO changes still held in the cache and closes the
+// database. If that fails, the changes are redone from the blocks when the
+// chain is next opened.
 func (bc *Blockchain) CloseDB() {
+	bc.closeSubscriptions()
+	bc.writeMu.Lock()
+	_ = bc.flushUTXOs()
+	bc.writeMu.Unlock()
 	_ = bc.db.Close()
 }
 
-func (bc *Blockchain) FindUTXO(address string) []TXOutput {
+func (bc *Blockchain) FindUTXO(address string) ([]TXOutput, error) {
 	var UTXOs []TXOutput
-	pubKeyHash := utils.Base58Decode([]byte(address))
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
-
-	unspentTxs := bc.FindUnspentTransactions(pubKeyHash)
+	pubKeyHash, err := wallet.AddressToPubKeyHash(address, bc.params.Bech32HRP)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, tx := range unspentTxs {
-		for _, out := range tx.Vout {
-			if out.CanBeUnlockedWith(pubKeyHash) {
-				UTXOs = append(UTXOs, out)
-			}
-		}
+	utxos, err := bc.FindUnspentOutputs(pubKeyHash)
+	if err != nil {
+		return nil, err
 	}
-	return UTXOs
-}
-
-func (bc *Blockchain) FindSpendableOutputs(pubKeyHash []byte, amount int) (int, map[string][]int) {
-	unspentOutputs := make(map[string][]int)
-	unspentTXs := bc.FindUnspentTransactions(pubKeyHash)
-	accumulated := 0
-Work:
-	for _, tx := range unspentTXs {
-		txID := hex.EncodeToString(tx.ID)
-		for outIdx, out := range tx.Vout {
-			if out.CanBeUnlockedWith(pubKeyHash) && accumulated < amount {
-				accumulated += out.Value
-				unspentOutputs[txID] = append(unspentOutputs[txID], outIdx)
-				if accumulated >= amount {
-					break Work
-				}
-			}
-		}
+	for _, utxo := range utxos {
+		UTXOs = append(UTXOs, utxo.Output)
 	}
-	return accumulated, unspentOutputs
+	return UTXOs, nil
 }
 
-func (bc *Blockchain) FindUnspentTransactions(pubKeyHash []byte) []Transaction {
-	var unspentTXs []Transaction
-	spentTXOs := make(map[string][]int)
-	bci := bc.Iterator()
-
+// MineBlock mines transactions into a new block on top of the tip and
+// connects it. The block is timestamped with the current time, or one second
+// past the median time past if the clock is behind it. Mining happens without
+// holding any lock; if another block is connected first, the block is mined
+// again on the new tip. If transactions doesn't start with a coinbase, one
+// claiming no reward is added, as every block must have one.
+func (bc *Blockchain) MineBlock(transactions []*Transaction) (*Block, error) {
+	if len(transactions) == 0 || !transactions[0].IsCoinbase() {
+		transactions = append([]*Transaction{newEmptyCoinbase("")}, transactions...)
+	}
 	for {
-		block := bci.Next()
-		if block == nil {
-			break
+		lastHash := bc.Tip()
+		timestamp := bc.now().Unix()
+		mtp, err := bc.medianTimePast(lastHash)
+		if err != nil {
+			return nil, err
 		}
-
-		for _, tx := range block.Transactions {
-			txID := hex.EncodeToString(tx.ID)
-
-		Outputs:
-			for outIdx, out := range tx.Vout {
-				if spentTXOs[txID] != nil {
-					for _, spentOut := range spentTXOs[txID] {
-						if spentOut == outIdx {
-							continue Outputs
-						}
-					}
-				}
-				if out.CanBeUnlockedWith(pubKeyHash) {
-					unspentTXs = append(unspentTXs, *tx)
-				}
-			}
-
-			if !tx.IsCoinbase() {
-				for _, in := range tx.Vin {
-					if in.CanUnlockOutputWith(pubKeyHash) {
-						inTxID := hex.EncodeToString(in.Txid)
-						spentTXOs[inTxID] = append(spentTXOs[inTxID], in.Vout)
-					}
-				}
-			}
+		if timestamp <= mtp {
+			timestamp = mtp + 1
 		}
-		if len(block.PrevBlockHash) == 0 {
-			break
+		bits, err := bc.nextBits(lastHash)
+		if err != nil {
+			return nil, err
+		}
+		newBlock := NewBlock(transactions, lastHash, bits, timestamp)
+		err = bc.AddBlock(newBlock)
+		if errors.Is(err, errStaleTip) {
+			continue
+		}
+		if err != nil {
+			return nil, err
 		}
+		return newBlock, nil
 	}
-	return unspentTXs
 }
 
-func (bc *Blockchain) MineBlock(transactions []*Transaction) {
-	var lastHash []byte
-	err := bc.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(dbLastHashKey))
+// AddBlock validates block and connects it on top of the current tip.
+func (bc *Blockchain) AddBlock(block *Block) error {
+	bc.writeMu.Lock()
+	defer bc.writeMu.Unlock()
+
+	err := bc.validateBlock(block)
+	if err != nil {
+		return fmt.Errorf("rejecting block %x: %w", block.Hash, err)
+	}
+	height, err := bc.getBlockHeight(block.PrevBlockHash)
+	if err != nil {
+		return err
+	}
+	// The UTXO changes go to the cache rather than this batch; until they
+	// are flushed, dbUTXOTipKey lags the tip and opening the chain redoes
+	// them from the blocks.
+	err = bc.db.Batch(func(b storage.Batch) error {
+		err := putBlock(b, block)
 		if err != nil {
 			return err
 		}
-		lastHash, err = item.ValueCopy(nil)
-		return err
-	})
-	if err != nil {
-		log.Panic(err)
-	}
-	difficulty := bc.GetDifficulty()
-	newBlock := NewBlock(transactions, lastHash, difficulty)
-	err = bc.db.Update(func(txn *badger.Txn) error {
-		err := txn.Set(newBlock.Hash, newBlock.Serialize())
+		err = b.Put([]byte(dbLastHashKey), block.Hash)
 		if err != nil {
 			return err
 		}
-		err = txn.Set([]byte(dbLastHashKey), newBlock.Hash)
-		bc.lastHash = newBlock.Hash
-		return err
+		return bc.fail(FailBeforeCommit)
 	})
 	if err != nil {
-		log.Panic(err)
+		return err
+	}
+	err = bc.fail(FailAfterCommit)
+	if err != nil {
+		return err
 	}
-}
+	// The caches keep a copy, which the caller can't modify afterwards.
+	cached := block.clone()
+	bc.utxoCache.connect(cached, height)
+	bc.headerCache.add(cached.Hash, &cached.BlockHeader)
+	bc.heightCache.add(cached.Hash, height+1)
+	bc.blockCache.add(cached.Hash, cached)
+	bc.tipMu.Lock()
+	bc.lastHash = block.Hash
+	bc.tipMu.Unlock()
 
-func (bc *Blockchain) getLatestBlock() *Block {
-	var lastBlock *Block
-	err := bc.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get([]byte(dbLastHashKey))
+	if bc.utxoCache.full() {
+		err = bc.flushUTXOs()
 		if err != nil {
 			return err
 		}
-		lastHash, err := item.ValueCopy(nil)
-		if err != nil {
-			return err
-		}
-		item, err = txn.Get(lastHash)
+	}
+	err = bc.pruneBlocks()
+	if err != nil {
+		return err
+	}
+
+	bc.removeFromMempool(block)
+	bc.publish(BlockConnected{cached.clone()}, TipChanged{bytes.Clone(block.Hash)})
+	return nil
+}
+
+// Generate mines n blocks on top of the current tip, each paying its coinbase
+// reward to address, and returns them in the order they were mined.
+func (bc *Blockchain) Generate(n int, address string) ([]*Block, error) {
+	var blocks []*Block
+	for i := 0; i < n; i++ {
+		cbtx, err := NewCoinbaseTX(address, "", bc.params.Bech32HRP)
 		if err != nil {
-			return err
+			return blocks, err
 		}
-		blockData, err := item.ValueCopy(nil)
+		block, err := bc.MineBlock([]*Transaction{cbtx})
 		if err != nil {
-			return err
+			return blocks, err
 		}
-		lastBlock = DeserializeBlock(blockData)
-		return nil
-	})
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+func (bc *Blockchain) getLatestHeader(tip []byte) (*BlockHeader, error) {
+	hi := bc.headerIteratorAt(tip)
+	header, _ := hi.Next()
+	return header, hi.Err()
+}
+
+// GetBlock returns a copy of the stored block with the given hash, which the
+// caller may modify. It fails with ErrPruned if the block's transactions have
+// been pruned.
+func (bc *Blockchain) GetBlock(blockHash []byte) (*Block, error) {
+	block, err := bc.getBlock(blockHash)
 	if err != nil {
-		log.Panic(err)
+		return nil, readError(blockHash, err)
 	}
-	return lastBlock
+	return block.clone(), nil
 }
 
+// getBlock returns a block through the block cache. Blocks in the cache are
+// shared and must not be modified.
 func (bc *Blockchain) getBlock(blockHash []byte) (*Block, error) {
-	var block *Block
-	err := bc.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(blockHash)
-		if err != nil {
-			return err
-		}
-		blockData, err := item.ValueCopy(nil)
-		if err != nil {
-			return err
-		}
-		block = DeserializeBlock(blockData)
-		return nil
-	})
+	if block, ok := bc.blockCache.get(blockHash); ok {
+		return block, nil
+	}
+	block, err := getBlock(bc.db, blockHash)
 	if err != nil {
 		return nil, err
 	}
+	bc.blockCache.add(blockHash, block)
 	return block, nil
 }
 
-func (bc *Blockchain) getBlockHeight() int {
-	var height int = 0
-	bci := bc.Iterator()
-	for {
-		block := bci.Next()
-		if block == nil {
+func (bc *Blockchain) getHeader(blockHash []byte) (*BlockHeader, error) {
+	if header, ok := bc.headerCache.get(blockHash); ok {
+		return header, nil
+	}
+	header, err := getHeader(bc.db, blockHash)
+	if err != nil {
+		return nil, err
+	}
+	bc.headerCache.add(blockHash, header)
+	return header, nil
+}
+
+// ChainWork returns the total work of the chain ending at the given block.
+func (bc *Blockchain) ChainWork(blockHash []byte) (*big.Int, error) {
+	return getChainWork(bc.db, blockHash)
+}
+
+// getBlockHeight returns the number of blocks up to and including tip. It
+// walks back only as far as the first block whose height is cached.
+func (bc *Blockchain) getBlockHeight(tip []byte) (int, error) {
+	height := 0
+	var walked [][]byte
+	for hash := tip; len(hash) != 0; {
+		if h, ok := bc.heightCache.get(hash); ok {
+			height = h
 			break
 		}
-		height++
-		if len(block.PrevBlockHash) == 0 {
-			break
+		header, err := bc.getHeader(hash)
+		if err != nil {
+			return 0, readError(hash, err)
 		}
+		walked = append(walked, hash)
+		hash = header.PrevBlockHash
 	}
-	return height
+	for i := len(walked) - 1; i >= 0; i-- {
+		height++
+		bc.heightCache.add(walked[i], height)
+	}
+	return height, nil
+}
+
+// NextBits returns the compact target the next block must be mined at.
+// Every DifficultyAdjustmentInterval blocks the target is scaled by how long
+// the interval actually took; in between it stays the same as the tip's.
+func (bc *Blockchain) NextBits() (uint32, error) {
+	return bc.nextBits(bc.Tip())
 }
 
-func (bc *Blockchain) GetDifficulty() int {
-	lastBlock := bc.getLatestBlock()
-	if lastBlock == nil {
-		return startDifficulty
+// nextBits returns the compact target of a block extending tip.
+func (bc *Blockchain) nextBits(tip []byte) (uint32, error) {
+	params := bc.params
+	if params.NoRetargeting {
+		return params.GenesisBits, nil
 	}
-	if (bc.getBlockHeight())%difficultyAdjustmentInterval != 0 {
-		return lastBlock.Difficulty
+	lastHeader, err := bc.getLatestHeader(tip)
+	if err != nil {
+		return 0, err
+	}
+	if lastHeader == nil {
+		return params.GenesisBits, nil
+	}
+	height, err := bc.getBlockHeight(tip)
+	if err != nil {
+		return 0, err
 	}
-	firstBlockOfInterval := lastBlock
-	for i := 1; i < difficultyAdjustmentInterval; i++ {
-		block, err := bc.getBlock(firstBlockOfInterval.PrevBlockHash)
+	if height%params.DifficultyAdjustmentInterval != 0 {
+		return lastHeader.Bits, nil
+	}
+	firstHeaderOfInterval := lastHeader
+	for i := 1; i < params.DifficultyAdjustmentInterval; i++ {
+		header, err := bc.getHeader(firstHeaderOfInterval.PrevBlockHash)
 		if err != nil {
-			return startDifficulty
-		}
-		firstBlockOfInterval = block
-	}
-	actualTime := lastBlock.Timestamp - firstBlockOfInterval.Timestamp
-	expectedTime := int64(difficultyAdjustmentInterval * targetBlockTime)
-	if actualTime < expectedTime/2 {
-		fmt.Println("Block time too fast, increasing difficulty")
-		return lastBlock.Difficulty + 1
-	} else if actualTime > expectedTime*2 {
-		fmt.Println("Block time too slow, decreasing difficulty")
-		if lastBlock.Difficulty > 1 {
-			return lastBlock.Difficulty - 1
+			return 0, err
 		}
+		firstHeaderOfInterval = header
 	}
-	return lastBlock.Difficulty
+	return retarget(params, firstHeaderOfInterval, lastHeader), nil
+}
+
+// retarget returns the bits of the block following the difficulty adjustment
+// interval that runs from first to last.
+func retarget(params *Params, first, last *BlockHeader) uint32 {
+	actualTime := last.Timestamp - first.Timestamp
+	expectedTime := int64(params.DifficultyAdjustmentInterval) * params.TargetBlockTime
+	bits := calcNextTarget(last.Bits, actualTime, expectedTime, params.PowLimit)
+	if bits != last.Bits {
+		fmt.Printf("Retargeting: interval took %ds, expected %ds, bits %08x -> %08x\n",
+			actualTime, expectedTime, last.Bits, bits)
+	}
+	return bits
 }
 
 func DbExists() bool {
-	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+	return ChainExists(Config{})
+}
+
+func ChainExists(cfg Config) bool {
+	if _, err := os.Stat(cfg.dbPath()); os.IsNotExist(err) {
 		return false
 	}
 	return true
@@ -0,0 +1,83 @@
+package blockchain_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Triad-0112/BlockChain.git/testutil"
+)
+
+// TestConcurrentAccess mines from several goroutines while others walk the
+// chain and look up balances. Run it with -race.
+func TestConcurrentAccess(t *testing.T) {
+	const (
+		miners         = 4
+		blocksPerMiner = 10
+		readers        = 4
+	)
+	h := testutil.NewDiskHarness(t)
+	addresses := make([]string, miners)
+	for i := range addresses {
+		addresses[i] = h.NewAddress()
+	}
+
+	var mining sync.WaitGroup
+	for _, address := range addresses {
+		mining.Add(1)
+		go func() {
+			defer mining.Done()
+			if _, err := h.Chain.Generate(blocksPerMiner, address); err != nil {
+				t.Errorf("Generate: %v", err)
+			}
+		}()
+	}
+
+	var done atomic.Bool
+	var reading sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		reading.Add(1)
+		go func() {
+			defer reading.Done()
+			for !done.Load() {
+				it := h.Chain.Iterator()
+				n := 0
+				for it.Next() != nil {
+					n++
+				}
+				if err := it.Err(); err != nil {
+					t.Errorf("Iterator: %v", err)
+					return
+				}
+				if n == 0 {
+					t.Error("Iterator returned no blocks")
+					return
+				}
+				for _, address := range addresses {
+					if _, err := h.Chain.FindUTXO(address); err != nil {
+						t.Errorf("FindUTXO: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	mining.Wait()
+	done.Store(true)
+	reading.Wait()
+
+	it := h.Chain.Iterator()
+	height := 0
+	for it.Next() != nil {
+		height++
+	}
+	if want := 1 + miners*blocksPerMiner; height != want {
+		t.Errorf("chain has %d blocks, want %d", height, want)
+	}
+	for _, address := range addresses {
+		if got, want := h.Balance(address), blocksPerMiner*100; got != want {
+			t.Errorf("balance of %s = %d, want %d", address, got, want)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package blockchain
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+)
+
+// Default cache sizes, in entries.
+const (
+	defaultHeaderCacheSize = 4096
+	defaultBlockCacheSize  = 64
+	defaultUTXOCacheSize   = 20000
+)
+
+// CacheSizes bounds the in-memory caches of a Blockchain, in entries. Zero
+// selects the default size and a negative one disables the cache.
+type CacheSizes struct {
+	// Headers bounds the decoded headers cached, and separately the block
+	// heights.
+	Headers int
+	// Blocks bounds the decoded blocks cached.
+	Blocks int
+	// UTXOs bounds the unspent outputs cached. Changes made by new blocks
+	// are kept in the cache and written to the database once this many are
+	// pending, before pruning and when the chain is closed.
+	UTXOs int
+}
+
+func cacheSize(size, def int) int {
+	if size == 0 {
+		return def
+	}
+	return max(size, 0)
+}
+
+// CacheStats counts the lookups served by a cache since the chain was opened.
+type CacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	Entries  int
+	Capacity int
+}
+
+// HitRate returns the fraction of lookups served from the cache, or 0 if
+// there were none.
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// CacheMetrics holds the statistics of every cache of a Blockchain. Entries
+// of UTXOs includes changes not yet written to the database.
+type CacheMetrics struct {
+	Headers CacheStats
+	Heights CacheStats
+	Blocks  CacheStats
+	UTXOs   CacheStats
+}
+
+// CacheStats reports how well the caches are doing.
+func (bc *Blockchain) CacheStats() CacheMetrics {
+	return CacheMetrics{
+		Headers: bc.headerCache.stats(),
+		Heights: bc.heightCache.stats(),
+		Blocks:  bc.blockCache.stats(),
+		UTXOs:   bc.utxoCache.stats(),
+	}
+}
+
+// lruCache holds up to capacity values, evicting the least recently used
+// first. A cache with no capacity holds nothing and counts every lookup as a
+// miss.
+type lruCache[V any] struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+	hits     uint64
+	misses   uint64
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newLRUCache[V any](capacity int) *lruCache[V] {
+	return &lruCache[V]{capacity: capacity, items: make(map[string]*list.Element), order: list.New()}
+}
+
+func (c *lruCache[V]) get(key []byte) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[string(key)]
+	if !ok {
+		c.misses++
+		var zero V
+		return zero, false
+	}
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[V]).value, true
+}
+
+func (c *lruCache[V]) add(key []byte, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.capacity == 0 {
+		return
+	}
+	if elem, ok := c.items[string(key)]; ok {
+		elem.Value.(*lruEntry[V]).value = value
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[string(key)] = c.order.PushFront(&lruEntry[V]{string(key), value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+func (c *lruCache[V]) remove(key []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[string(key)]; ok {
+		c.order.Remove(elem)
+		delete(c.items, string(key))
+	}
+}
+
+func (c *lruCache[V]) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.order.Len(), Capacity: c.capacity}
+}
+
+// utxoCache sits in front of the UTXO set in the database. Entries read from
+// the database are kept in clean; changes made by connected blocks are kept
+// in dirty, a nil value marking a spent output, until flush writes them out.
+// The lock is held across database reads, so a read can't put back an output
+// a block spent meanwhile.
+type utxoCache struct {
+	mu     sync.Mutex
+	limit  int
+	clean  *lruCache[[]byte]
+	dirty  map[string][]byte
+	hits   uint64
+	misses uint64
+}
+
+func newUTXOCache(limit int) *utxoCache {
+	return &utxoCache{limit: limit, clean: newLRUCache[[]byte](limit), dirty: make(map[string][]byte)}
+}
+
+// get returns the encoded entry stored under key, or storage.ErrNotFound if
+// the output is missing or spent.
+func (c *utxoCache) get(db storage.Reader, key []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if val, ok := c.dirty[string(key)]; ok {
+		c.hits++
+		if val == nil {
+			return nil, storage.ErrNotFound
+		}
+		return val, nil
+	}
+	if val, ok := c.clean.get(key); ok {
+		c.hits++
+		return val, nil
+	}
+	c.misses++
+	val, err := db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	c.clean.add(key, val)
+	return val, nil
+}
+
+// connect records the outputs block spends and creates. height is the number
+// of blocks before it.
+func (c *utxoCache) connect(block *Block, height int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Vin {
+				key := utxoKey(in.Outpoint())
+				c.dirty[string(key)] = nil
+				c.clean.remove(key)
+			}
+		}
+		for vout, out := range tx.Vout {
+			c.dirty[string(utxoKey(Outpoint{tx.ID, vout}))] = encodeUTXOEntry(height, i, out)
+		}
+	}
+}
+
+// full reports whether enough changes are pending to be flushed.
+func (c *utxoCache) full() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.dirty) > 0 && len(c.dirty) >= c.limit
+}
+
+// pending returns a copy of the changes not yet written to the database.
+func (c *utxoCache) pending() map[string][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dirty := make(map[string][]byte, len(c.dirty))
+	for k, v := range c.dirty {
+		dirty[k] = v
+	}
+	return dirty
+}
+
+// flush writes the pending changes to db, recording tip as the block the
+// UTXO set now matches. The changes are written in several batches if need
+// be; dbUTXOTipKey only moves with the last, so a flush cut short is redone
+// from the blocks when the chain is next opened.
+func (c *utxoCache) flush(db storage.Store, tip []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.dirty) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(c.dirty))
+	for k := range c.dirty {
+		keys = append(keys, k)
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), maxBatchWrites)
+		last := n == len(keys)
+		err := db.Batch(func(b storage.Batch) error {
+			for _, k := range keys[:n] {
+				var err error
+				if val := c.dirty[k]; val == nil {
+					err = b.Delete([]byte(k))
+				} else {
+					err = b.Put([]byte(k), val)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if last {
+				return b.Put([]byte(dbUTXOTipKey), tip)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	for k, v := range c.dirty {
+		if v != nil {
+			c.clean.add([]byte(k), v)
+		}
+	}
+	c.dirty = make(map[string][]byte)
+	return nil
+}
+
+func (c *utxoCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clean := c.clean.stats()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: clean.Entries + len(c.dirty), Capacity: c.limit}
+}
+
+// flushUTXOs writes the UTXO changes held in the cache to the database.
+func (bc *Blockchain) flushUTXOs() error {
+	err := bc.fail(FailBeforeFlush)
+	if err != nil {
+		return err
+	}
+	return bc.utxoCache.flush(bc.db, bc.Tip())
+}
@@ -0,0 +1,194 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+func TestLRUCacheEviction(t *testing.T) {
+	c := newLRUCache[int](2)
+	c.add([]byte("a"), 1)
+	c.add([]byte("b"), 2)
+	if _, ok := c.get([]byte("a")); !ok {
+		t.Fatal("a missing")
+	}
+	// b is now the least recently used.
+	c.add([]byte("c"), 3)
+	if _, ok := c.get([]byte("b")); ok {
+		t.Error("b was not evicted")
+	}
+	for key, want := range map[string]int{"a": 1, "c": 3} {
+		if got, ok := c.get([]byte(key)); !ok || got != want {
+			t.Errorf("get(%s) = %d, %v, want %d, true", key, got, ok, want)
+		}
+	}
+	want := CacheStats{Hits: 3, Misses: 1, Entries: 2, Capacity: 2}
+	if got := c.stats(); got != want {
+		t.Errorf("stats = %+v, want %+v", got, want)
+	}
+
+	disabled := newLRUCache[int](0)
+	disabled.add([]byte("a"), 1)
+	if _, ok := disabled.get([]byte("a")); ok {
+		t.Error("a cache with no capacity held a value")
+	}
+	want = CacheStats{Misses: 1}
+	if got := disabled.stats(); got != want {
+		t.Errorf("stats of a disabled cache = %+v, want %+v", got, want)
+	}
+}
+
+func TestUTXOCacheCounters(t *testing.T) {
+	db := storage.NewMemory()
+	stored := utxoKey(Outpoint{[]byte("stored"), 0})
+	if err := db.Put(stored, []byte("entry")); err != nil {
+		t.Fatal(err)
+	}
+	c := newUTXOCache(10)
+	tx := &Transaction{ID: []byte("new"), Vin: []TXInput{{Txid: []byte("stored"), Vout: 0}}, Vout: []TXOutput{{1, nil}}}
+	created := utxoKey(Outpoint{tx.ID, 0})
+
+	// A miss reads the database and a second lookup is served from memory.
+	for range 2 {
+		if _, err := c.get(db, stored); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.connect(&Block{Transactions: []*Transaction{tx}}, 1)
+	if _, err := c.get(db, created); err != nil {
+		t.Fatal(err)
+	}
+	// Spent outputs are hits too: the cache knows they are gone.
+	if _, err := c.get(db, stored); err != storage.ErrNotFound {
+		t.Fatalf("get of a spent output: got %v, want ErrNotFound", err)
+	}
+	stats := c.stats()
+	if stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("hits, misses = %d, %d, want 3, 1", stats.Hits, stats.Misses)
+	}
+}
+
+// countingStore records how many writes each batch committed to it makes.
+type countingStore struct {
+	storage.Store
+	batches []int
+	tipIn   []bool
+}
+
+type countingBatch struct {
+	storage.Batch
+	writes int
+	tip    bool
+}
+
+func (b *countingBatch) Put(key, value []byte) error {
+	b.writes++
+	b.tip = b.tip || string(key) == dbUTXOTipKey
+	return b.Batch.Put(key, value)
+}
+
+func (b *countingBatch) Delete(key []byte) error {
+	b.writes++
+	return b.Batch.Delete(key)
+}
+
+func (s *countingStore) Batch(fn func(storage.Batch) error) error {
+	return s.Store.Batch(func(b storage.Batch) error {
+		counted := &countingBatch{Batch: b}
+		err := fn(counted)
+		s.batches = append(s.batches, counted.writes)
+		s.tipIn = append(s.tipIn, counted.tip)
+		return err
+	})
+}
+
+func TestUTXOCacheFlushInBatches(t *testing.T) {
+	db := &countingStore{Store: storage.NewMemory()}
+	c := newUTXOCache(3 * maxBatchWrites)
+	tx := &Transaction{ID: []byte("big"), Vout: make([]TXOutput, maxBatchWrites+5)}
+	for i := range tx.Vout {
+		tx.Vout[i] = TXOutput{1, []byte("owner")}
+	}
+	c.connect(&Block{Transactions: []*Transaction{tx}}, 1)
+	if err := c.flush(db, []byte("tip")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(db.batches) != 2 {
+		t.Fatalf("flushed in %d batches, want 2", len(db.batches))
+	}
+	for i, writes := range db.batches {
+		if writes > maxBatchWrites+1 {
+			t.Errorf("batch %d made %d writes, more than %d", i, writes, maxBatchWrites+1)
+		}
+		if last := i == len(db.batches)-1; db.tipIn[i] != last {
+			t.Errorf("batch %d wrote the UTXO tip: %v, want %v", i, db.tipIn[i], last)
+		}
+	}
+	tip, err := db.Get([]byte(dbUTXOTipKey))
+	if err != nil || !bytes.Equal(tip, []byte("tip")) {
+		t.Errorf("UTXO tip = %q, %v, want \"tip\"", tip, err)
+	}
+	n := 0
+	err = db.Iterate([]byte{utxoKeyPrefix}, func(_, _ []byte) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(tx.Vout) {
+		t.Errorf("%d outputs stored, want %d", n, len(tx.Vout))
+	}
+	if stats := c.stats(); stats.Entries != len(tx.Vout) {
+		t.Errorf("%d entries cached after the flush, want %d", stats.Entries, len(tx.Vout))
+	}
+}
+
+func TestCachedBlocksNotShared(t *testing.T) {
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := string(w.GetAddress())
+	bc, err := CreateBlockchain(address, Config{Params: &RegTestParams, InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.CloseDB()
+	events, cancel := bc.Subscribe()
+	defer cancel()
+
+	mined, err := bc.Generate(1, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := bytes.Clone(mined[0].Hash)
+	connected := (<-events).(BlockConnected).Block
+	got, err := bc.GetBlock(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterated := bc.Iterator().Next()
+	header, _ := bc.HeaderIterator().Next()
+	for _, block := range []*Block{mined[0], connected, got, iterated} {
+		block.Transactions[0].Vout[0].Value = 0
+		block.Transactions = nil
+		block.Timestamp = 0
+	}
+	header.MerkleRoot[0] ^= 0xff
+
+	block, err := bc.GetBlock(hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(block.BlockHeader.Hash(), hash) || !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		t.Fatal("cached block was modified")
+	}
+	if got := block.Transactions[0].Vout[0].Value; got != blockReward {
+		t.Errorf("cached coinbase pays %d, want %d", got, blockReward)
+	}
+}
@@ -0,0 +1,149 @@
+package blockchain
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// UTXO is an unspent output together with the outpoint that identifies it.
+type UTXO struct {
+	Outpoint
+	Output TXOutput
+}
+
+// CoinSelector picks which of utxos to spend to pay amount. The selection
+// may total more than amount; the difference becomes change.
+type CoinSelector func(utxos []UTXO, amount int) ([]UTXO, error)
+
+var coinSelectors = map[string]CoinSelector{
+	"largest":  LargestFirst,
+	"smallest": SmallestFirst,
+	"bnb":      BranchAndBound,
+	"random":   RandomSelection,
+}
+
+// DefaultCoinSelector is used when no strategy is given.
+var DefaultCoinSelector CoinSelector = BranchAndBound
+
+// CoinSelectorByName returns the strategy registered under name.
+func CoinSelectorByName(name string) (CoinSelector, error) {
+	selector, ok := coinSelectors[name]
+	if !ok {
+		var names []string
+		for name := range coinSelectors {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown coin selection strategy %q (want one of %s)", name, strings.Join(names, ", "))
+	}
+	return selector, nil
+}
+
+func sumUTXOs(utxos []UTXO) int {
+	total := 0
+	for _, utxo := range utxos {
+		total += utxo.Output.Value
+	}
+	return total
+}
+
+func insufficientFunds(utxos []UTXO, amount int) error {
+	return fmt.Errorf("%w: have %d, need %d", ErrInsufficientFunds, sumUTXOs(utxos), amount)
+}
+
+// accumulate takes utxos in order until they cover amount.
+func accumulate(utxos []UTXO, amount int) ([]UTXO, error) {
+	var selected []UTXO
+	total := 0
+	for _, utxo := range utxos {
+		if total >= amount {
+			break
+		}
+		selected = append(selected, utxo)
+		total += utxo.Output.Value
+	}
+	if total < amount {
+		return nil, insufficientFunds(utxos, amount)
+	}
+	return selected, nil
+}
+
+func sortedByValue(utxos []UTXO, descending bool) []UTXO {
+	sorted := append([]UTXO{}, utxos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if descending {
+			return sorted[i].Output.Value > sorted[j].Output.Value
+		}
+		return sorted[i].Output.Value < sorted[j].Output.Value
+	})
+	return sorted
+}
+
+// LargestFirst spends the biggest outputs first, using as few inputs as
+// possible.
+func LargestFirst(utxos []UTXO, amount int) ([]UTXO, error) {
+	return accumulate(sortedByValue(utxos, true), amount)
+}
+
+// SmallestFirst spends the smallest outputs first, consolidating dust at the
+// cost of larger transactions.
+func SmallestFirst(utxos []UTXO, amount int) ([]UTXO, error) {
+	return accumulate(sortedByValue(utxos, false), amount)
+}
+
+// RandomSelection spends outputs in random order, which makes it harder to
+// link a wallet's payments by their input patterns.
+func RandomSelection(utxos []UTXO, amount int) ([]UTXO, error) {
+	shuffled := append([]UTXO{}, utxos...)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return accumulate(shuffled, amount)
+}
+
+// bnbMaxTries bounds the depth-first search of BranchAndBound.
+const bnbMaxTries = 100000
+
+// BranchAndBound searches for a set of outputs adding up to exactly amount,
+// so the transaction needs no change output. When there is no exact match
+// within bnbMaxTries steps it falls back to LargestFirst.
+func BranchAndBound(utxos []UTXO, amount int) ([]UTXO, error) {
+	sorted := sortedByValue(utxos, true)
+
+	// remaining[i] is the total value of sorted[i:], used to prune branches
+	// that can no longer reach amount.
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Output.Value
+	}
+
+	var selected []int
+	tries := 0
+	var search func(i, total int) bool
+	search = func(i, total int) bool {
+		tries++
+		if total == amount {
+			return true
+		}
+		if total > amount || i == len(sorted) || total+remaining[i] < amount || tries > bnbMaxTries {
+			return false
+		}
+		selected = append(selected, i)
+		if search(i+1, total+sorted[i].Output.Value) {
+			return true
+		}
+		selected = selected[:len(selected)-1]
+		return search(i+1, total)
+	}
+
+	if search(0, 0) {
+		var result []UTXO
+		for _, i := range selected {
+			result = append(result, sorted[i])
+		}
+		return result, nil
+	}
+	return LargestFirst(utxos, amount)
+}
@@ -0,0 +1,88 @@
+package blockchain
+
+import "math/big"
+
+// Targets are stored in block headers in Bitcoin's compact "bits" form: the
+// high byte is the length of the target in bytes and the low three bytes are
+// its most significant bytes. Bit 0x00800000 is a sign bit; targets are never
+// negative, so BigToCompact shifts the mantissa to keep it clear.
+
+// CompactToBig expands compact bits into the full target.
+func CompactToBig(bits uint32) *big.Int {
+	mantissa := int64(bits & 0x007fffff)
+	exponent := uint(bits >> 24)
+
+	target := big.NewInt(mantissa)
+	if exponent <= 3 {
+		target.Rsh(target, 8*(3-exponent))
+	} else {
+		target.Lsh(target, 8*(exponent-3))
+	}
+	if bits&0x00800000 != 0 {
+		target.Neg(target)
+	}
+	return target
+}
+
+// BigToCompact returns the compact form of target, dropping any precision
+// beyond the three mantissa bytes.
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(target.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(target.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		t := new(big.Int).Rsh(target, 8*(exponent-3))
+		mantissa = uint32(t.Bits()[0])
+	}
+
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	bits := uint32(exponent<<24) | mantissa
+	if target.Sign() < 0 {
+		bits |= 0x00800000
+	}
+	return bits
+}
+
+// CalcWork returns the expected number of hashes needed to find a block at
+// the given bits: 2^256 / (target + 1).
+func CalcWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() <= 0 {
+		return big.NewInt(0)
+	}
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	numerator := new(big.Int).Lsh(big.NewInt(1), 256)
+	return numerator.Div(numerator, denominator)
+}
+
+// calcNextTarget scales the previous target by how long the last interval
+// actually took compared to how long it should have taken. The adjustment is
+// clamped to a factor of four either way and never exceeds powLimit.
+func calcNextTarget(prevBits uint32, actualTime, expectedTime int64, powLimit *big.Int) uint32 {
+	// The clamped targets are computed exactly; dividing expectedTime by
+	// four first would round it down and let the target drop further.
+	target := CompactToBig(prevBits)
+	switch {
+	case actualTime*4 < expectedTime:
+		target.Rsh(target, 2)
+	case actualTime > expectedTime*4:
+		target.Lsh(target, 2)
+	default:
+		target.Mul(target, big.NewInt(actualTime))
+		target.Div(target, big.NewInt(expectedTime))
+	}
+	if target.Cmp(powLimit) > 0 {
+		target.Set(powLimit)
+	}
+	return BigToCompact(target)
+}
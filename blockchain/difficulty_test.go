@@ -0,0 +1,98 @@
+package blockchain
+
+import (
+	"math/big"
+	"testing"
+)
+
+func bigHex(t *testing.T, s string) *big.Int {
+	t.Helper()
+	n, ok := new(big.Int).SetString(s, 0)
+	if !ok {
+		t.Fatalf("bad number %q", s)
+	}
+	return n
+}
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		want string
+	}{
+		{0, "0"},
+		{0x01120000, "0x12"},
+		{0x02123400, "0x1234"},
+		{0x03123456, "0x123456"},
+		{0x04123456, "0x12345600"},
+		{0x04923456, "-0x12345600"},
+		{0x1d00ffff, "0xffff0000000000000000000000000000000000000000000000000000"},
+	}
+	for _, tt := range tests {
+		if got := CompactToBig(tt.bits); got.Cmp(bigHex(t, tt.want)) != 0 {
+			t.Errorf("CompactToBig(%08x) = %#x, want %s", tt.bits, got, tt.want)
+		}
+	}
+}
+
+func TestBigToCompact(t *testing.T) {
+	tests := []struct {
+		target string
+		want   uint32
+	}{
+		{"0", 0},
+		{"0x12", 0x01120000},
+		{"0x80", 0x02008000},
+		{"0x1234", 0x02123400},
+		{"0x12345600", 0x04123456},
+		{"-0x12345600", 0x04923456},
+		{"0x123456789", 0x05012345},
+		{"0xffff0000000000000000000000000000000000000000000000000000", 0x1d00ffff},
+	}
+	for _, tt := range tests {
+		if got := BigToCompact(bigHex(t, tt.target)); got != tt.want {
+			t.Errorf("BigToCompact(%s) = %08x, want %08x", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestCalcWork(t *testing.T) {
+	tests := []struct {
+		bits uint32
+		want string
+	}{
+		{0, "0"},
+		{0x04923456, "0"},
+		{0x207fffff, "2"},
+		{0x1d00ffff, "0x100010001"},
+	}
+	for _, tt := range tests {
+		if got := CalcWork(tt.bits); got.Cmp(bigHex(t, tt.want)) != 0 {
+			t.Errorf("CalcWork(%08x) = %#x, want %s", tt.bits, got, tt.want)
+		}
+	}
+}
+
+func TestCalcNextTarget(t *testing.T) {
+	noLimit := CompactToBig(0x207fffff)
+	tests := []struct {
+		name     string
+		actual   int64
+		powLimit *big.Int
+		want     uint32
+	}{
+		{"instant", 0, noLimit, 0x1e100000},
+		// 18 is below 75/4 but not below 75/4 rounded down.
+		{"just too fast", 18, noLimit, 0x1e100000},
+		{"fast", 19, noLimit, 0x1e10369d},
+		{"on time", 75, noLimit, 0x1e400000},
+		{"slow", 150, noLimit, 0x1f008000},
+		{"just too slow", 301, noLimit, 0x1f010000},
+		{"very slow", 1_000_000, noLimit, 0x1f010000},
+		{"capped", 301, CompactToBig(0x1e7fffff), 0x1e7fffff},
+	}
+	for _, tt := range tests {
+		if got := calcNextTarget(0x1e400000, tt.actual, 75, tt.powLimit); got != tt.want {
+			t.Errorf("%s: calcNextTarget(0x1e400000, %d, 75) = %08x, want %08x", tt.name, tt.actual, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+// Errors returned by the blockchain API. They are usually wrapped with more
+// detail, so compare with errors.Is.
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrChainExists       = errors.New("blockchain already exists")
+	ErrChainNotFound     = errors.New("no existing blockchain found")
+	ErrInvalidAddress    = wallet.ErrInvalidAddress
+	ErrCorruptBlock      = errors.New("corrupt block")
+	// ErrNeedsMigration is returned when opening a database written in an
+	// older storage format; MigrateGobDB converts it.
+	ErrNeedsMigration = errors.New("blockchain database needs migration")
+	// ErrWrongNetwork is returned when importing blocks exported from
+	// another network.
+	ErrWrongNetwork = errors.New("blocks belong to another network")
+	// ErrPruned is returned when reading block data deleted by pruning.
+	ErrPruned = errors.New("block data has been pruned")
+	// ErrMissingOutput is returned when a transaction spends an output that
+	// doesn't exist or was spent by a block already connected.
+	ErrMissingOutput = errors.New("missing or already spent output")
+	// ErrDoubleSpend is returned when a transaction spends an output that is
+	// also spent by another of its inputs, another transaction in the same
+	// block or a transaction waiting in the mempool.
+	ErrDoubleSpend = errors.New("double spend")
+	// ErrDuplicateTransaction is returned when a transaction has the ID of
+	// one whose outputs are not all spent, which it would overwrite.
+	ErrDuplicateTransaction = errors.New("transaction ID already has unspent outputs")
+	// ErrReindexing is returned when opening a chain whose reindex was
+	// interrupted; ReindexBlockchain finishes it.
+	ErrReindexing = errors.New("an interrupted reindex has to be finished first")
+)
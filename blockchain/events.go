@@ -0,0 +1,158 @@
+package blockchain
+
+import "sync"
+
+// Event is a change to the chain or mempool delivered to subscribers. It is
+// one of BlockConnected, BlockDisconnected, TipChanged or
+// TxAcceptedToMempool.
+type Event interface {
+	isEvent()
+}
+
+// BlockConnected is sent after a block has been stored and made the tip.
+// Block is a copy made for the event, shared by every subscriber, so it must
+// not be modified.
+type BlockConnected struct {
+	Block *Block
+}
+
+// BlockDisconnected is sent when a block is removed from the tip of the
+// chain. The chain only grows today, so it is not sent yet; subscribers
+// should still handle it.
+type BlockDisconnected struct {
+	Block *Block
+}
+
+// TipChanged is sent whenever the tip moves, after the corresponding
+// BlockConnected or BlockDisconnected.
+type TipChanged struct {
+	Hash []byte
+}
+
+// TxAcceptedToMempool is sent when a verified transaction is waiting to be
+// mined.
+type TxAcceptedToMempool struct {
+	Tx *Transaction
+}
+
+func (BlockConnected) isEvent()      {}
+func (BlockDisconnected) isEvent()   {}
+func (TipChanged) isEvent()          {}
+func (TxAcceptedToMempool) isEvent() {}
+
+// subscription queues events for one subscriber, so a slow reader never
+// blocks the chain and never misses an event.
+type subscription struct {
+	ch     chan Event
+	mu     sync.Mutex
+	queue  []Event
+	wake   chan struct{}
+	closed bool
+}
+
+func newSubscription() *subscription {
+	s := &subscription{ch: make(chan Event), wake: make(chan struct{}, 1)}
+	go s.deliver()
+	return s
+}
+
+func (s *subscription) push(e Event) {
+	s.mu.Lock()
+	if !s.closed {
+		s.queue = append(s.queue, e)
+	}
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.signal()
+}
+
+func (s *subscription) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver forwards queued events to ch in order. Once closed, events still
+// queued are dropped and ch is closed.
+func (s *subscription) deliver() {
+	defer close(s.ch)
+	for range s.wake {
+		for {
+			s.mu.Lock()
+			if s.closed {
+				s.mu.Unlock()
+				return
+			}
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			e := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case s.ch <- e:
+			case <-s.wake:
+				// Woken while blocked on a slow reader: either more
+				// events were queued or the subscription was closed.
+				s.mu.Lock()
+				closed := s.closed
+				if !closed {
+					s.queue = append([]Event{e}, s.queue...)
+				}
+				s.mu.Unlock()
+				if closed {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every event from now on, in the order
+// they happened, and a function that cancels the subscription and closes the
+// channel. Closing the chain cancels every subscription.
+func (bc *Blockchain) Subscribe() (<-chan Event, func()) {
+	s := newSubscription()
+	bc.subsMu.Lock()
+	if bc.subs == nil {
+		bc.subs = make(map[*subscription]bool)
+	}
+	bc.subs[s] = true
+	bc.subsMu.Unlock()
+
+	cancel := func() {
+		bc.subsMu.Lock()
+		delete(bc.subs, s)
+		bc.subsMu.Unlock()
+		s.close()
+	}
+	return s.ch, cancel
+}
+
+func (bc *Blockchain) publish(events ...Event) {
+	bc.subsMu.Lock()
+	defer bc.subsMu.Unlock()
+	for s := range bc.subs {
+		for _, e := range events {
+			s.push(e)
+		}
+	}
+}
+
+func (bc *Blockchain) closeSubscriptions() {
+	bc.subsMu.Lock()
+	defer bc.subsMu.Unlock()
+	for s := range bc.subs {
+		s.close()
+	}
+	bc.subs = nil
+}
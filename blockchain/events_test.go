@@ -0,0 +1,147 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/testutil"
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+func nextEvent(t *testing.T, events <-chan blockchain.Event) blockchain.Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event delivered")
+		return nil
+	}
+}
+
+// waitClosed reads events until the channel is closed and returns how many
+// there were.
+func waitClosed(t *testing.T, events <-chan blockchain.Event) int {
+	t.Helper()
+	n := 0
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-events:
+			if !ok {
+				return n
+			}
+			n++
+		case <-timeout:
+			t.Fatal("subscription not closed")
+		}
+	}
+}
+
+// wantBlockEvents checks that events continues with BlockConnected and
+// TipChanged for each of blocks in turn.
+func wantBlockEvents(t *testing.T, events <-chan blockchain.Event, blocks []*blockchain.Block) {
+	t.Helper()
+	for _, block := range blocks {
+		connected, ok := nextEvent(t, events).(blockchain.BlockConnected)
+		if !ok || !bytes.Equal(connected.Block.Hash, block.Hash) {
+			t.Fatalf("got %#v, want BlockConnected for %x", connected, block.Hash)
+		}
+		tip, ok := nextEvent(t, events).(blockchain.TipChanged)
+		if !ok || !bytes.Equal(tip.Hash, block.Hash) {
+			t.Fatalf("got %#v, want TipChanged to %x", tip, block.Hash)
+		}
+	}
+}
+
+func TestEventsInOrder(t *testing.T) {
+	h := testutil.NewHarness(t)
+	to := h.NewAddress()
+	events, cancel := h.Chain.Subscribe()
+	defer cancel()
+
+	blocks := h.Generate(3, h.Miner)
+	tx := h.Send(h.Miner, to, 30)
+	blocks = append(blocks, h.Chain.Iterator().Next())
+
+	wantBlockEvents(t, events, blocks[:3])
+	accepted, ok := nextEvent(t, events).(blockchain.TxAcceptedToMempool)
+	if !ok || !bytes.Equal(accepted.Tx.ID, tx.ID) {
+		t.Fatalf("got %#v, want TxAcceptedToMempool for %x", accepted, tx.ID)
+	}
+	wantBlockEvents(t, events, blocks[3:])
+}
+
+func TestSlowSubscriberDoesNotBlock(t *testing.T) {
+	h := testutil.NewHarness(t)
+	slow, cancelSlow := h.Chain.Subscribe()
+	defer cancelSlow()
+	fast, cancelFast := h.Chain.Subscribe()
+	defer cancelFast()
+
+	// Nobody reads slow while the blocks are mined, so mining would hang
+	// if publishing waited for it.
+	mined := make(chan []*blockchain.Block)
+	go func() {
+		blocks, err := h.Chain.Generate(50, h.Miner)
+		if err != nil {
+			t.Error(err)
+		}
+		mined <- blocks
+	}()
+	var blocks []*blockchain.Block
+	select {
+	case blocks = <-mined:
+	case <-time.After(10 * time.Second):
+		t.Fatal("mining blocked on a subscriber that isn't reading")
+	}
+
+	wantBlockEvents(t, fast, blocks)
+	wantBlockEvents(t, slow, blocks)
+}
+
+func TestCancelSubscription(t *testing.T) {
+	h := testutil.NewHarness(t)
+	events, cancel := h.Chain.Subscribe()
+	other, cancelOther := h.Chain.Subscribe()
+	defer cancelOther()
+
+	h.Generate(1, h.Miner)
+	cancel()
+	// Events not yet read when cancelling are dropped.
+	waitClosed(t, events)
+	cancel()
+
+	blocks := h.Generate(1, h.Miner)
+	nextEvent(t, other)
+	nextEvent(t, other)
+	wantBlockEvents(t, other, blocks)
+}
+
+func TestCloseEndsSubscriptions(t *testing.T) {
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := string(w.GetAddress())
+	bc, err := blockchain.CreateBlockchain(address, blockchain.Config{Params: &blockchain.RegTestParams, InMemory: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := bc.Subscribe()
+	if _, err := bc.Generate(2, address); err != nil {
+		t.Fatal(err)
+	}
+
+	bc.CloseDB()
+	if n := waitClosed(t, events); n > 4 {
+		t.Errorf("%d events delivered, want at most the 4 published", n)
+	}
+	// Cancelling after the chain closed is harmless.
+	cancel()
+}
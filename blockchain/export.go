@@ -0,0 +1,155 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+)
+
+// An exported chain is a sequence of records from genesis to tip, each the
+// network's magic and the length of the block as little-endian uint32s
+// followed by the block's canonical encoding.
+
+// maxExportedBlockSize bounds the length prefix, so a corrupt file can't make
+// import allocate arbitrary amounts of memory.
+const maxExportedBlockSize = 32 << 20
+
+// Export writes every block from genesis to the current tip to w, calling
+// progress, if not nil, with the height of each block written.
+func (bc *Blockchain) Export(w io.Writer, progress func(height int)) error {
+	// Walk back by header to learn the order, then write forwards.
+	var hashes [][]byte
+	hi := bc.HeaderIterator()
+	for {
+		header, hash := hi.Next()
+		if header == nil {
+			break
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := hi.Err(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	var prefix [8]byte
+	binary.LittleEndian.PutUint32(prefix[:4], bc.params.Magic)
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := bc.GetBlock(hashes[i])
+		if err != nil {
+			return err
+		}
+
+		data := block.Serialize()
+		binary.LittleEndian.PutUint32(prefix[4:], uint32(len(data)))
+		if _, err := bw.Write(prefix[:]); err != nil {
+			return err
+		}
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(len(hashes) - i)
+		}
+	}
+	return bw.Flush()
+}
+
+// ImportBlockchain reads blocks written by Export from r and connects them to
+// the chain cfg points at, creating it if there is none. Blocks the chain
+// already has are skipped, so a file can be imported again after an
+// interruption or to catch up a copy of the same chain. progress, if not nil,
+// is called with the height of each block read. A chain created here is
+// removed again if not even its genesis block could be imported.
+func ImportBlockchain(r io.Reader, cfg Config, progress func(height int)) (*Blockchain, error) {
+	bc, created, err := openForImport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = bc.importBlocks(bufio.NewReader(r), progress)
+	if err == nil && len(bc.Tip()) == 0 {
+		err = errors.New("no blocks to import")
+	}
+	if err != nil {
+		empty := len(bc.Tip()) == 0
+		bc.CloseDB()
+		if created && empty && !cfg.InMemory {
+			_ = os.RemoveAll(cfg.dbPath())
+		}
+		return nil, err
+	}
+	return bc, nil
+}
+
+// openForImport loads the chain cfg points at, or creates an empty one with
+// no genesis block, reporting whether it did.
+func openForImport(cfg Config) (*Blockchain, bool, error) {
+	if !cfg.InMemory && ChainExists(cfg) {
+		err := removeIncompleteDB(cfg)
+		if errors.Is(err, ErrChainExists) {
+			bc, err := LoadBlockchain(cfg)
+			return bc, false, err
+		}
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	db, err := cfg.openDB()
+	if err != nil {
+		return nil, false, err
+	}
+	err = db.Put([]byte(dbFormatKey), []byte{dbFormatVersion})
+	if err != nil {
+		_ = db.Close()
+		return nil, false, err
+	}
+	return newBlockchain(db, nil, cfg), true, nil
+}
+
+func (bc *Blockchain) importBlocks(r io.Reader, progress func(height int)) error {
+	var prefix [8]byte
+	for height := 1; ; height++ {
+		_, err := io.ReadFull(r, prefix[:])
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: reading block %d: %w", ErrCorruptBlock, height, err)
+		}
+		magic := binary.LittleEndian.Uint32(prefix[:4])
+		if magic != bc.params.Magic {
+			return fmt.Errorf("%w: block %d has magic %08x, expected %08x for %s",
+				ErrWrongNetwork, height, magic, bc.params.Magic, bc.params.Name)
+		}
+		size := binary.LittleEndian.Uint32(prefix[4:])
+		if size > maxExportedBlockSize {
+			return fmt.Errorf("%w: block %d is %d bytes, more than %d", ErrCorruptBlock, height, size, maxExportedBlockSize)
+		}
+		data := make([]byte, size)
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return fmt.Errorf("%w: reading block %d: %w", ErrCorruptBlock, height, err)
+		}
+		block, err := DeserializeBlock(data)
+		if err != nil {
+			return fmt.Errorf("block %d: %w", height, err)
+		}
+
+		_, err = bc.getHeader(block.Hash)
+		if errors.Is(err, storage.ErrNotFound) {
+			err = bc.AddBlock(block)
+		}
+		if err != nil {
+			return fmt.Errorf("block %d: %w", height, err)
+		}
+		if progress != nil {
+			progress(height)
+		}
+	}
+}
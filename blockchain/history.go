@@ -0,0 +1,58 @@
+package blockchain
+
+// HistoryEntry records how one transaction changed the balance of an address.
+type HistoryEntry struct {
+	TxID      []byte
+	BlockHash []byte
+	Timestamp int64
+	Received  int
+	Sent      int
+}
+
+// History lists the transactions paying to or spending from pubKeyHash,
+// newest first.
+func (bc *Blockchain) History(pubKeyHash []byte) ([]HistoryEntry, error) {
+	var history []HistoryEntry
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+		if block == nil {
+			break
+		}
+
+		for _, tx := range block.Transactions {
+			entry := HistoryEntry{TxID: tx.ID, BlockHash: block.Hash, Timestamp: block.Timestamp}
+			for _, out := range tx.Vout {
+				if out.CanBeUnlockedWith(pubKeyHash) {
+					entry.Received += out.Value
+				}
+			}
+
+			spends := false
+			if !tx.IsCoinbase() {
+				for _, in := range tx.Vin {
+					if in.CanUnlockOutputWith(pubKeyHash) {
+						spends = true
+					}
+				}
+			}
+			if spends {
+				prevOuts, err := bc.PrevOutputs(tx)
+				if err != nil {
+					return nil, err
+				}
+				for _, in := range tx.Vin {
+					if in.CanUnlockOutputWith(pubKeyHash) {
+						entry.Sent += prevOuts[in.Outpoint().String()].Value
+					}
+				}
+			}
+
+			if entry.Received != 0 || entry.Sent != 0 {
+				history = append(history, entry)
+			}
+		}
+	}
+	return history, bci.Err()
+}
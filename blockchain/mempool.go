@@ -0,0 +1,79 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// AcceptTransaction verifies tx against the chain and adds it to the mempool,
+// where it waits until a block including it is connected. It fails with
+// ErrDoubleSpend if a transaction in the mempool spends one of the same
+// outputs, and with ErrDuplicateTransaction if its ID is already in use.
+func (bc *Blockchain) AcceptTransaction(tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return fmt.Errorf("transaction %x: coinbase transactions can't be relayed", tx.ID)
+	}
+	err := bc.checkNewID(tx)
+	if err != nil {
+		return err
+	}
+	err = bc.VerifyTransaction(tx)
+	if err != nil {
+		return fmt.Errorf("transaction %x: %w", tx.ID, err)
+	}
+
+	bc.mempoolMu.Lock()
+	if bc.mempool == nil {
+		bc.mempool = make(map[string]*Transaction)
+	}
+	id := hex.EncodeToString(tx.ID)
+	_, known := bc.mempool[id]
+	if !known {
+		spent := make(map[string][]byte)
+		for _, other := range bc.mempool {
+			_ = addSpends(spent, other)
+		}
+		if err := addSpends(spent, tx); err != nil {
+			bc.mempoolMu.Unlock()
+			return fmt.Errorf("transaction %x: %w", tx.ID, err)
+		}
+	}
+	bc.mempool[id] = tx
+	bc.mempoolMu.Unlock()
+
+	if !known {
+		bc.publish(TxAcceptedToMempool{tx})
+	}
+	return nil
+}
+
+// MempoolTransactions returns the transactions waiting to be mined.
+func (bc *Blockchain) MempoolTransactions() []*Transaction {
+	bc.mempoolMu.Lock()
+	defer bc.mempoolMu.Unlock()
+	var txs []*Transaction
+	for _, tx := range bc.mempool {
+		txs = append(txs, tx)
+	}
+	return txs
+}
+
+// removeFromMempool drops the transactions of a connected block, and those
+// spending an output the block spent, which can no longer be mined.
+func (bc *Blockchain) removeFromMempool(block *Block) {
+	bc.mempoolMu.Lock()
+	defer bc.mempoolMu.Unlock()
+	spent := make(map[string][]byte)
+	for _, tx := range block.Transactions {
+		delete(bc.mempool, hex.EncodeToString(tx.ID))
+		_ = addSpends(spent, tx)
+	}
+	for id, tx := range bc.mempool {
+		for _, in := range tx.Vin {
+			if _, ok := spent[in.Outpoint().String()]; ok {
+				delete(bc.mempool, id)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package blockchain
+
+import "crypto/sha256"
+
+// merkleRoot builds a Merkle tree over hashes and returns its root. Like
+// Bitcoin, a level with an odd number of nodes pairs its last node with
+// itself.
+func merkleRoot(hashes [][]byte) []byte {
+	if len(hashes) == 0 {
+		root := sha256.Sum256(nil)
+		return root[:]
+	}
+
+	level := append([][]byte{}, hashes...)
+	for len(level) > 1 {
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			pair := append(append([]byte{}, level[i]...), level[i+1]...)
+			hash := sha256.Sum256(pair)
+			next = append(next, hash[:])
+		}
+		level = next
+	}
+	return level[0]
+}
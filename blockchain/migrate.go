@@ -0,0 +1,297 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+)
+
+// dbLegacyBlocksKey holds the number of blocks MigrateGobDB converted, as a
+// uvarint. Only that many blocks from genesis may be migrated ones.
+const dbLegacyBlocksKey = "lg"
+
+// dbMigrateKey is present while MigrateGobDB is under way and holds the hash
+// of the last block it converted.
+const dbMigrateKey = "mg"
+
+// gobBlock is the layout blocks had when they were stored with encoding/gob.
+type gobBlock struct {
+	Timestamp     int64
+	Transactions  []*Transaction
+	PrevBlockHash []byte
+	Hash          []byte
+	Nonce         int
+	Difficulty    int
+}
+
+// MigrateDB brings the database cfg points at up to the current storage
+// format and returns the format it had. Gob-encoded databases are converted
+// with MigrateGobDB; format 4, which predates the UTXO set, gets one built
+// from its blocks.
+func MigrateDB(cfg Config) (int, error) {
+	db, err := cfg.openDB()
+	if err != nil {
+		return 0, err
+	}
+	version, err := formatVersion(db)
+	if err != nil {
+		_ = db.Close()
+		return 0, err
+	}
+	switch version {
+	case 0:
+		_ = db.Close()
+		_, err := MigrateGobDB(cfg)
+		return version, err
+	case 4:
+		defer db.Close()
+		err := rebuildUTXOSet(db)
+		if err != nil {
+			return version, err
+		}
+		return version, db.Put([]byte(dbFormatKey), []byte{dbFormatVersion})
+	case dbFormatVersion:
+		_ = db.Close()
+		return version, fmt.Errorf("database already uses storage format %d", version)
+	default:
+		_ = db.Close()
+		return version, fmt.Errorf("storage format %d can't be migrated; re-create the chain or import it with importchain", version)
+	}
+}
+
+// MigrateGobDB converts a database written with encoding/gob to the canonical
+// encoding and returns the number of blocks converted.
+//
+// Re-encoding a transaction changes its ID, so every input is re-pointed at
+// the new ID of the transaction it spends, and each coinbase gets the height
+// of its block added to its data to keep the IDs apart; blocks without a
+// coinbase get one claiming no reward. Block hashes change with their
+// contents as well, so each block is mined again with the bits the current
+// rules require, its timestamp moved past the median time past if need be.
+// The blocks are marked with legacyBlockVersion, as their inputs were never
+// signed.
+//
+// The converted blocks are written in batches of at most about
+// maxBatchWrites, next to the legacy ones, with dbMigrateKey recording the
+// last of them; an interrupted migration resumes after it. The format marker
+// and tip only switch to the converted chain once all of it is written, and
+// the legacy blocks are deleted after that.
+func MigrateGobDB(cfg Config) (int, error) {
+	db, err := cfg.openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	version, err := formatVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version != 0 {
+		return 0, fmt.Errorf("database already uses storage format %d", version)
+	}
+
+	var legacy []*gobBlock
+	hash, err := db.Get([]byte(dbLastHashKey))
+	if err != nil {
+		return 0, err
+	}
+	for len(hash) != 0 {
+		data, err := db.Get(hash)
+		if err != nil {
+			return 0, fmt.Errorf("reading block %x: %w", hash, err)
+		}
+		var block gobBlock
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&block)
+		if err != nil {
+			return 0, fmt.Errorf("decoding block %x: %w", hash, err)
+		}
+		legacy = append(legacy, &block)
+		hash = block.PrevBlockHash
+	}
+	slices.Reverse(legacy)
+	txs := convertTransactions(legacy)
+
+	headers, err := migratedHeaders(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(headers) > len(legacy) {
+		return 0, fmt.Errorf("%w: %d blocks migrated of a chain of %d", ErrCorruptBlock, len(headers), len(legacy))
+	}
+	prevHash := []byte{}
+	if len(headers) > 0 {
+		prevHash = headers[len(headers)-1].Hash()
+		fmt.Printf("Resuming the migration at block %d of %d\n", len(headers)+1, len(legacy))
+	}
+
+	params := cfg.params()
+	for height := len(headers); height < len(legacy); {
+		var chunk []*Block
+		writes := 0
+		for ; height < len(legacy); height++ {
+			n := blockWrites(txs[height])
+			if writes > 0 && writes+n > maxBatchWrites {
+				break
+			}
+			writes += n
+			block := &Block{
+				BlockHeader: BlockHeader{
+					Version:       legacyBlockVersion,
+					PrevBlockHash: prevHash,
+					Timestamp:     legacy[height].Timestamp,
+					Bits:          params.GenesisBits,
+				},
+				Transactions: txs[height],
+			}
+			if height > 0 {
+				last := headers[height-1]
+				timestamps := make([]int64, 0, medianTimeBlocks)
+				for _, h := range headers[max(0, height-medianTimeBlocks):] {
+					timestamps = append(timestamps, h.Timestamp)
+				}
+				if mtp := medianTime(timestamps); block.Timestamp <= mtp {
+					block.Timestamp = mtp + 1
+				}
+				if !params.NoRetargeting {
+					block.Bits = last.Bits
+					if interval := params.DifficultyAdjustmentInterval; height%interval == 0 {
+						block.Bits = retarget(params, headers[height-interval], last)
+					}
+				}
+			}
+			block.MerkleRoot = block.HashTransactions()
+			block.Nonce, block.Hash = NewProofOfWork(&block.BlockHeader).Run()
+			chunk = append(chunk, block)
+			headers = append(headers, &block.BlockHeader)
+			prevHash = block.Hash
+		}
+		err := db.Batch(func(b storage.Batch) error {
+			first := len(headers) - len(chunk)
+			for i, block := range chunk {
+				err := putBlock(b, block)
+				if err != nil {
+					return err
+				}
+				err = connectUTXOs(b, block, first+i)
+				if err != nil {
+					return err
+				}
+			}
+			return b.Put([]byte(dbMigrateKey), prevHash)
+		})
+		if err != nil {
+			return 0, err
+		}
+		err = failAt(cfg.FailPoint, FailAfterCommit)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = db.Batch(func(b storage.Batch) error {
+		if len(legacy) > 0 {
+			if err := b.Put([]byte(dbLastHashKey), prevHash); err != nil {
+				return err
+			}
+			if err := b.Put([]byte(dbUTXOTipKey), prevHash); err != nil {
+				return err
+			}
+		}
+		err := b.Put([]byte(dbLegacyBlocksKey), binary.AppendUvarint(nil, uint64(len(legacy))))
+		if err != nil {
+			return err
+		}
+		err = b.Delete([]byte(dbMigrateKey))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(dbFormatKey), []byte{dbFormatVersion})
+	})
+	if err != nil {
+		return 0, err
+	}
+	keys := make([][]byte, len(legacy))
+	for i, block := range legacy {
+		keys[i] = block.Hash
+	}
+	return len(legacy), deleteKeys(db, keys)
+}
+
+// convertTransactions returns the transactions of the legacy blocks, oldest
+// first, re-encoded as described at MigrateGobDB. The result depends only on
+// the blocks, so a resumed migration gets the same IDs as the first attempt.
+func convertTransactions(legacy []*gobBlock) [][]*Transaction {
+	// Legacy coinbases paying the same address with the same data share an
+	// ID, so an old ID can stand for several transactions; an input spends
+	// the first of them whose output hasn't been spent yet.
+	txIDs := make(map[string][][]byte)
+	spent := make(map[string]bool)
+	converted := make([][]*Transaction, len(legacy))
+	for height, old := range legacy {
+		txs := old.Transactions
+		if len(txs) == 0 || !txs[0].IsCoinbase() {
+			txs = append([]*Transaction{newEmptyCoinbase("Migrated block")}, txs...)
+		}
+		for _, tx := range txs {
+			oldID := hex.EncodeToString(tx.ID)
+			tx.Version = txVersion
+			if tx.IsCoinbase() {
+				tx.Vin[0].PubKey = append(tx.Vin[0].PubKey, fmt.Sprintf(" (block %d)", height+1)...)
+			} else {
+				for j, in := range tx.Vin {
+					for _, newID := range txIDs[hex.EncodeToString(in.Txid)] {
+						outpoint := Outpoint{newID, in.Vout}.String()
+						if !spent[outpoint] {
+							tx.Vin[j].Txid = newID
+							spent[outpoint] = true
+							break
+						}
+					}
+				}
+			}
+			tx.SetID()
+			txIDs[oldID] = append(txIDs[oldID], tx.ID)
+		}
+		converted[height] = txs
+	}
+	return converted
+}
+
+// migratedHeaders returns the headers of the blocks an interrupted migration
+// already wrote, oldest first.
+func migratedHeaders(r storage.Reader) ([]*BlockHeader, error) {
+	hash, err := getKey(r, dbMigrateKey)
+	if err != nil {
+		return nil, err
+	}
+	var headers []*BlockHeader
+	for len(hash) != 0 {
+		header, err := getHeader(r, hash)
+		if err != nil {
+			return nil, readError(hash, err)
+		}
+		headers = append(headers, header)
+		hash = header.PrevBlockHash
+	}
+	slices.Reverse(headers)
+	return headers, nil
+}
+
+// blockWrites returns how many writes storing a block of txs and its UTXOs
+// takes: its header, body and chainwork, and one per input and output.
+func blockWrites(txs []*Transaction) int {
+	n := 3
+	for _, tx := range txs {
+		if !tx.IsCoinbase() {
+			n += len(tx.Vin)
+		}
+		n += len(tx.Vout)
+	}
+	return n
+}
@@ -0,0 +1,261 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+// writeGobChain stores blocks holding transactions the way the gob format
+// did, every one with the same timestamp.
+func writeGobChain(t *testing.T, db storage.Store, blocks [][]*Transaction) {
+	t.Helper()
+	prevHash := []byte{}
+	for i, txs := range blocks {
+		hash := sha256.Sum256([]byte{byte(i)})
+		block := gobBlock{Timestamp: 1_700_000_000, Transactions: txs, PrevBlockHash: prevHash, Hash: hash[:], Difficulty: 8}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(block); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put(hash[:], buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		prevHash = hash[:]
+	}
+	if err := db.Put([]byte(dbLastHashKey), prevHash); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// migratedChain writes a gob chain in which alice mines five blocks and pays
+// bob 30 twice, migrates it and reindexes it.
+func migratedChain(t *testing.T) (Config, *wallet.Wallet, *wallet.Wallet) {
+	t.Helper()
+	cfg := Config{Params: &MainNetParams, DBPath: filepath.Join(t.TempDir(), "blocks")}
+	alice, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The old mine command gave every coinbase the same data, and so the
+	// same ID, and spends carried no signature.
+	reward := func() *Transaction {
+		return &Transaction{
+			ID:   []byte("reward"),
+			Vin:  []TXInput{{Txid: []byte{}, Vout: -1, PubKey: []byte("Miner Reward")}},
+			Vout: []TXOutput{{100, alice.PubKeyHash()}},
+		}
+	}
+	spend := func(id string) *Transaction {
+		return &Transaction{
+			ID:   []byte(id),
+			Vin:  []TXInput{{Txid: []byte("reward"), Vout: 0, PubKey: alice.PublicKey}},
+			Vout: []TXOutput{{30, bob.PubKeyHash()}, {70, alice.PubKeyHash()}},
+		}
+	}
+	legacy := [][]*Transaction{
+		{reward()}, {reward()}, {reward()}, {spend("spend 1")}, {reward()}, {spend("spend 2")}, {reward()},
+	}
+
+	db, err := cfg.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeGobChain(t, db, legacy)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateGobDB(cfg); err != nil {
+		t.Fatal(err)
+	}
+	n, err := ReindexBlockchain(cfg, nil)
+	if err != nil {
+		t.Fatalf("reindexing the migrated chain: %v", err)
+	}
+	if n != len(legacy) {
+		t.Errorf("reindexed %d blocks, want %d", n, len(legacy))
+	}
+	return cfg, alice, bob
+}
+
+func balanceOf(t *testing.T, bc *Blockchain, pubKeyHash []byte) int {
+	t.Helper()
+	utxos, err := bc.FindUnspentOutputs(pubKeyHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := 0
+	for _, utxo := range utxos {
+		balance += utxo.Output.Value
+	}
+	return balance
+}
+
+func TestMigratedChainValidates(t *testing.T) {
+	cfg, alice, bob := migratedChain(t)
+	bc, err := LoadBlockchain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.CloseDB()
+	if got, want := balanceOf(t, bc, alice.PubKeyHash()), 5*100-2*30; got != want {
+		t.Errorf("balance of alice = %d, want %d", got, want)
+	}
+	if got, want := balanceOf(t, bc, bob.PubKeyHash()), 2*30; got != want {
+		t.Errorf("balance of bob = %d, want %d", got, want)
+	}
+
+	// Only reindexing trusts the unsigned migrated blocks.
+	var exported bytes.Buffer
+	if err := bc.Export(&exported, nil); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportBlockchain(&exported, Config{Params: &MainNetParams, InMemory: true}, nil)
+	if err == nil {
+		imported.CloseDB()
+		t.Fatal("importchain accepted migrated blocks")
+	}
+}
+
+func TestNewLegacyBlockRejected(t *testing.T) {
+	cfg, alice, _ := migratedChain(t)
+	bc, err := LoadBlockchain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.CloseDB()
+	attacker, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A block claiming to be migrated, on top of the migrated ones, spending
+	// alice's output without a signature.
+	utxos, err := bc.FindUnspentOutputs(alice.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	theft := &Transaction{
+		Version: txVersion,
+		Vin:     []TXInput{{Txid: utxos[0].Txid, Vout: utxos[0].Vout, PubKey: alice.PublicKey}},
+		Vout:    []TXOutput{{utxos[0].Output.Value, attacker.PubKeyHash()}},
+	}
+	theft.SetID()
+	bits, err := bc.NextBits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtp, err := bc.medianTimePast(bc.Tip())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := &Block{
+		BlockHeader: BlockHeader{
+			Version:       legacyBlockVersion,
+			PrevBlockHash: bc.Tip(),
+			Timestamp:     mtp + 1,
+			Bits:          bits,
+		},
+		Transactions: []*Transaction{newEmptyCoinbase(""), theft},
+	}
+	block.MerkleRoot = block.HashTransactions()
+	block.Nonce, block.Hash = NewProofOfWork(&block.BlockHeader).Run()
+
+	err = bc.AddBlock(block)
+	if err == nil || !strings.Contains(err.Error(), "only accepted when reindexing") {
+		t.Fatalf("AddBlock: got %v, want migrated blocks refused", err)
+	}
+	if got := balanceOf(t, bc, attacker.PubKeyHash()); got != 0 {
+		t.Errorf("attacker balance = %d, want 0", got)
+	}
+}
+
+func TestMigrationResumesInChunks(t *testing.T) {
+	cfg := Config{Params: &RegTestParams, DBPath: filepath.Join(t.TempDir(), "blocks")}
+	alice, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough outputs that the converted chain takes more than one batch.
+	outputs := make([]TXOutput, 100)
+	for i := range outputs {
+		outputs[i] = TXOutput{1, alice.PubKeyHash()}
+	}
+	legacy := make([][]*Transaction, maxBatchWrites/len(outputs)+20)
+	for i := range legacy {
+		legacy[i] = []*Transaction{{
+			ID:   []byte("reward"),
+			Vin:  []TXInput{{Txid: []byte{}, Vout: -1, PubKey: []byte("Miner Reward")}},
+			Vout: outputs,
+		}}
+	}
+	db, err := cfg.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeGobChain(t, db, legacy)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	errCrash := errors.New("crash")
+	cfg.FailPoint = func(p FailPoint) error {
+		if p == FailAfterCommit {
+			return errCrash
+		}
+		return nil
+	}
+	if _, err := MigrateGobDB(cfg); !errors.Is(err, errCrash) {
+		t.Fatalf("MigrateGobDB: got %v, want the crash after the first batch", err)
+	}
+	if _, err := LoadBlockchain(cfg); !errors.Is(err, ErrNeedsMigration) {
+		t.Fatalf("LoadBlockchain after an interrupted migration: got %v, want ErrNeedsMigration", err)
+	}
+	cfg.FailPoint = nil
+	n, err := MigrateGobDB(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(legacy) {
+		t.Errorf("migrated %d blocks, want %d", n, len(legacy))
+	}
+
+	db, err = cfg.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Iterate(nil, func(key, _ []byte) error {
+		if len(key) == sha256.Size {
+			t.Errorf("legacy block %x left behind", key)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReindexBlockchain(cfg, nil); err != nil {
+		t.Fatalf("reindexing the migrated chain: %v", err)
+	}
+	bc, err := LoadBlockchain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.CloseDB()
+	if got, want := balanceOf(t, bc, alice.PubKeyHash()), len(legacy)*len(outputs); got != want {
+		t.Errorf("balance of alice = %d, want %d", got, want)
+	}
+}
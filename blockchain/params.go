@@ -0,0 +1,47 @@
+package blockchain
+
+import "math/big"
+
+// Params holds the consensus rules and default storage location of a network.
+type Params struct {
+	Name   string
+	DBPath string
+	// PowLimit is the easiest target a block may have; GenesisBits is the
+	// compact target the genesis block is mined at.
+	PowLimit                     *big.Int
+	GenesisBits                  uint32
+	DifficultyAdjustmentInterval int
+	TargetBlockTime              int64
+	// NoRetargeting pins every block to GenesisBits, so blocks can be
+	// produced instantly regardless of how fast they are mined.
+	NoRetargeting bool
+	// Bech32HRP is the human-readable prefix of bech32 addresses created
+	// for the network.
+	Bech32HRP string
+	// Magic tags every block in an exported chain file, so blocks of one
+	// network can't be imported into another.
+	Magic uint32
+}
+
+var MainNetParams = Params{
+	Name:                         "main",
+	DBPath:                       "./tmp/blocks",
+	PowLimit:                     CompactToBig(0x1f00ffff),
+	GenesisBits:                  0x1e400000,
+	DifficultyAdjustmentInterval: 5,
+	TargetBlockTime:              15,
+	Bech32HRP:                    "gc",
+	Magic:                        0x6763f1a9,
+}
+
+var RegTestParams = Params{
+	Name:                         "regtest",
+	DBPath:                       "./tmp/regtest/blocks",
+	PowLimit:                     CompactToBig(0x207fffff),
+	GenesisBits:                  0x207fffff,
+	DifficultyAdjustmentInterval: 5,
+	TargetBlockTime:              15,
+	NoRetargeting:                true,
+	Bech32HRP:                    "gcrt",
+	Magic:                        0x6763da5e,
+}
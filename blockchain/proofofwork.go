@@ -1,39 +1,27 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/sha256"
 	"fmt"
 	"math"
 	"math/big"
-	"strconv"
 )
 
 type ProofOfWork struct {
-	block  *Block
+	header *BlockHeader
 	target *big.Int
 }
 
-func NewProofOfWork(b *Block) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-b.Difficulty))
-
-	pow := &ProofOfWork{b, target}
+func NewProofOfWork(h *BlockHeader) *ProofOfWork {
+	pow := &ProofOfWork{h, CompactToBig(h.Bits)}
 	return pow
 }
 
+// prepareData returns the serialized header with its nonce set to nonce.
 func (pow *ProofOfWork) prepareData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			pow.block.PrevBlockHash,
-			pow.block.HashTransactions(),
-			[]byte(strconv.FormatInt(pow.block.Timestamp, 10)),
-			[]byte(strconv.FormatInt(int64(pow.block.Difficulty), 10)),
-			[]byte(strconv.FormatInt(int64(nonce), 10)),
-		},
-		[]byte{},
-	)
-	return data
+	header := *pow.header
+	header.Nonce = nonce
+	return header.Serialize()
 }
 
 func (pow *ProofOfWork) Run() (int, []byte) {
@@ -61,7 +49,7 @@ func (pow *ProofOfWork) Run() (int, []byte) {
 
 func (pow *ProofOfWork) Validate() bool {
 	var hashInt big.Int
-	data := pow.prepareData(pow.block.Nonce)
+	data := pow.prepareData(pow.header.Nonce)
 	hash := sha256.Sum256(data)
 	hashInt.SetBytes(hash[:])
 
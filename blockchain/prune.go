@@ -0,0 +1,60 @@
+package blockchain
+
+import (
+	"errors"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+)
+
+// pruneBlocks deletes the bodies of blocks more than bc.prune blocks below
+// the tip, walking back until it reaches a body that is already gone. Headers,
+// chainwork and the UTXO set are kept.
+func (bc *Blockchain) pruneBlocks() error {
+	if bc.prune <= 0 {
+		return nil
+	}
+	var stale [][]byte
+	hash := bc.Tip()
+	for depth := 0; len(hash) != 0; depth++ {
+		header, err := bc.getHeader(hash)
+		if err != nil {
+			return readError(hash, err)
+		}
+		if depth >= bc.prune {
+			_, err := bc.db.Get(bodyKey(hash))
+			if errors.Is(err, storage.ErrNotFound) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			stale = append(stale, hash)
+		}
+		hash = header.PrevBlockHash
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	// The UTXO set must be up to date in the database first: opening the
+	// chain redoes pending changes from the blocks, which need their bodies.
+	err := bc.flushUTXOs()
+	if err != nil {
+		return err
+	}
+	// Mark the database pruned before any body goes, so a missing body is
+	// never mistaken for corruption.
+	err = bc.db.Put([]byte(dbPrunedKey), []byte{})
+	if err != nil {
+		return err
+	}
+	keys := make([][]byte, len(stale))
+	for i, hash := range stale {
+		keys[i] = bodyKey(hash)
+	}
+	err = deleteKeys(bc.db, keys)
+	for _, hash := range stale {
+		bc.blockCache.remove(hash)
+	}
+	return err
+}
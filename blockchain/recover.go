@@ -0,0 +1,192 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+)
+
+// FailPoint names a step of a database write at which Config.FailPoint can
+// simulate a crash.
+type FailPoint string
+
+const (
+	// FailBeforeCommit is reached once everything connecting a block has
+	// been written, just before the batch is committed.
+	FailBeforeCommit FailPoint = "before-commit"
+	// FailAfterCommit is reached once a block is committed, before the
+	// in-memory tip moves and subscribers are told.
+	FailAfterCommit FailPoint = "after-commit"
+	// FailBeforeFlush is reached before the UTXO changes held in the cache
+	// are written out. Failing there when the chain is closed loses them,
+	// as a crash would.
+	FailBeforeFlush FailPoint = "before-flush"
+	// FailBeforeRename is reached once a new chain's genesis block is stored
+	// in the temporary directory, before it is moved into place.
+	FailBeforeRename FailPoint = "before-rename"
+)
+
+func failAt(hook func(FailPoint) error, point FailPoint) error {
+	if hook == nil {
+		return nil
+	}
+	return hook(point)
+}
+
+func (bc *Blockchain) fail(point FailPoint) error {
+	return failAt(bc.failPoint, point)
+}
+
+// createDB builds a new database with write in a temporary directory next to
+// cfg's path and renames it into place once write has succeeded. Leftovers of
+// an earlier attempt that died part way are removed first.
+func createDB(cfg Config, write func(storage.Store) error) (storage.Store, error) {
+	path := cfg.dbPath()
+	tmp := path + ".new"
+	err := os.RemoveAll(tmp)
+	if err != nil {
+		return nil, err
+	}
+	db, err := cfg.openDBAt(tmp)
+	if err != nil {
+		return nil, err
+	}
+	err = write(db)
+	if err != nil {
+		_ = db.Close()
+		_ = os.RemoveAll(tmp)
+		return nil, err
+	}
+	err = failAt(cfg.FailPoint, FailBeforeRename)
+	if err != nil {
+		// Like a crash, leave the temporary directory behind.
+		_ = db.Close()
+		return nil, err
+	}
+	err = db.Close()
+	if err != nil {
+		return nil, err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.openDB()
+}
+
+// removeIncompleteDB deletes the database at cfg's path if it has no tip,
+// which happens when an import, or creation by an older version, was
+// interrupted before the genesis block was stored. It fails with ErrChainExists if there is a chain there.
+func removeIncompleteDB(cfg Config) error {
+	db, err := cfg.openDB()
+	if err != nil {
+		return err
+	}
+	tip, err := readTip(db)
+	_ = db.Close()
+	if err != nil {
+		return err
+	}
+	if tip != nil {
+		return fmt.Errorf("%w at %s", ErrChainExists, cfg.dbPath())
+	}
+	fmt.Printf("Removing incomplete blockchain database at %s\n", cfg.dbPath())
+	return os.RemoveAll(cfg.dbPath())
+}
+
+var errNoTip = fmt.Errorf("%w: the database has no tip; it was left by an interrupted createblockchain or importchain", ErrChainNotFound)
+
+func readTip(db storage.Reader) ([]byte, error) {
+	return getKey(db, dbLastHashKey)
+}
+
+// checkConsistency verifies that the tip of db is stored and that the UTXO
+// set matches it, repairing what it can, and returns the tip. A tip pointing
+// at a missing block is moved back to the block the UTXO set matches; a
+// UTXO set behind the tip is brought up to date from the blocks after the one
+// it matches, and one matching no block is rebuilt.
+func checkConsistency(db storage.Store) ([]byte, error) {
+	tip, err := getKey(db, dbLastHashKey)
+	if err != nil {
+		return nil, err
+	}
+	utxoTip, err := getKey(db, dbUTXOTipKey)
+	if err != nil {
+		return nil, err
+	}
+	tipStored, err := hasHeader(db, tip)
+	if err != nil {
+		return nil, err
+	}
+	utxoTipStored, err := hasHeader(db, utxoTip)
+	if err != nil {
+		return nil, err
+	}
+	if tip == nil {
+		return nil, errNoTip
+	}
+
+	if !tipStored {
+		if !utxoTipStored {
+			return nil, fmt.Errorf("%w: tip %x is missing", ErrCorruptBlock, tip)
+		}
+		fmt.Printf("Repairing tip: block %x is missing, falling back to %x\n", tip, utxoTip)
+		err := db.Put([]byte(dbLastHashKey), utxoTip)
+		if err != nil {
+			return nil, err
+		}
+		return utxoTip, nil
+	}
+
+	if utxoTip == nil {
+		fmt.Println("Repairing UTXO set: it is not known to match any block")
+		err := rebuildUTXOSet(db)
+		if err != nil {
+			return nil, fmt.Errorf("rebuilding UTXO set: %w", err)
+		}
+	} else if !bytes.Equal(tip, utxoTip) {
+		// Changes held in the cache were lost, or the set was damaged.
+		fmt.Printf("Updating UTXO set: it matches block %x but the tip is %x\n", utxoTip, tip)
+		err := catchUpUTXOSet(db, utxoTip)
+		if err != nil {
+			return nil, fmt.Errorf("updating UTXO set: %w", err)
+		}
+	}
+	return tip, nil
+}
+
+// getKey returns a copy of the value of key, or nil if it is not set.
+func getKey(r storage.Reader, key string) ([]byte, error) {
+	val, err := r.Get([]byte(key))
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	return val, err
+}
+
+func hasKey(r storage.Reader, key string) (bool, error) {
+	_, err := r.Get([]byte(key))
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func hasHeader(r storage.Reader, hash []byte) (bool, error) {
+	if len(hash) == 0 {
+		return false, nil
+	}
+	_, err := r.Get(headerKey(hash))
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
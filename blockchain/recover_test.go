@@ -0,0 +1,114 @@
+package blockchain_test
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/testutil"
+)
+
+func chainLength(t *testing.T, bc *blockchain.Blockchain) int {
+	t.Helper()
+	it := bc.HeaderIterator()
+	n := 0
+	for header, _ := it.Next(); header != nil; header, _ = it.Next() {
+		n++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestFailBeforeCommit(t *testing.T) {
+	h := testutil.NewDiskHarness(t)
+	address := h.NewAddress()
+	tip := h.Chain.Tip()
+
+	h.CrashAt(blockchain.FailBeforeCommit)
+	if _, err := h.Chain.Generate(1, address); !errors.Is(err, testutil.ErrCrash) {
+		t.Fatalf("Generate: got %v, want ErrCrash", err)
+	}
+	h.Restart()
+
+	if !bytes.Equal(h.Chain.Tip(), tip) {
+		t.Errorf("tip moved to %x, want %x", h.Chain.Tip(), tip)
+	}
+	if got := h.Balance(address); got != 0 {
+		t.Errorf("balance = %d, want 0", got)
+	}
+	h.Generate(1, address)
+	if got := h.Balance(address); got != 100 {
+		t.Errorf("balance after mining = %d, want 100", got)
+	}
+}
+
+func TestFailAfterCommit(t *testing.T) {
+	h := testutil.NewDiskHarness(t)
+	address := h.NewAddress()
+
+	h.CrashAt(blockchain.FailAfterCommit)
+	if _, err := h.Chain.Generate(1, address); !errors.Is(err, testutil.ErrCrash) {
+		t.Fatalf("Generate: got %v, want ErrCrash", err)
+	}
+	h.Restart()
+
+	if got := chainLength(t, h.Chain); got != 2 {
+		t.Errorf("chain has %d blocks, want 2", got)
+	}
+	if got := h.Balance(address); got != 100 {
+		t.Errorf("balance = %d, want 100", got)
+	}
+}
+
+func TestFailBeforeRename(t *testing.T) {
+	h := testutil.NewHarness(t)
+	cfg := blockchain.Config{
+		Params: &blockchain.RegTestParams,
+		DBPath: filepath.Join(t.TempDir(), "blocks"),
+		FailPoint: func(point blockchain.FailPoint) error {
+			if point == blockchain.FailBeforeRename {
+				return testutil.ErrCrash
+			}
+			return nil
+		},
+	}
+	if _, err := blockchain.CreateBlockchain(h.Miner, cfg); !errors.Is(err, testutil.ErrCrash) {
+		t.Fatalf("CreateBlockchain: got %v, want ErrCrash", err)
+	}
+	if blockchain.ChainExists(cfg) {
+		t.Fatal("an interrupted createblockchain left a chain behind")
+	}
+
+	cfg.FailPoint = nil
+	bc, err := blockchain.CreateBlockchain(h.Miner, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.CloseDB()
+	if got := chainLength(t, bc); got != 1 {
+		t.Errorf("chain has %d blocks, want 1", got)
+	}
+}
+
+func TestCrashLosesUTXOCache(t *testing.T) {
+	h := testutil.NewDiskHarness(t)
+	address := h.NewAddress()
+	h.Generate(3, address)
+	tip := h.Chain.Tip()
+
+	h.Crash()
+
+	if !bytes.Equal(h.Chain.Tip(), tip) {
+		t.Errorf("tip moved to %x, want %x", h.Chain.Tip(), tip)
+	}
+	if got := h.Balance(address); got != 300 {
+		t.Errorf("balance = %d, want 300", got)
+	}
+	if got := h.Balance(h.Miner); got != 100 {
+		t.Errorf("miner balance = %d, want 100", got)
+	}
+}
@@ -0,0 +1,190 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+)
+
+// dbReindexKey is present while a reindex is under way and holds the number
+// of blocks it has processed, as a uvarint, so an interrupted reindex can
+// carry on where it stopped. The chain can't be opened while it is set.
+const dbReindexKey = "ri"
+
+// ReindexBlockchain rebuilds everything derived from the blocks of the chain
+// cfg points at: the chainwork of every block and the UTXO set. It walks the
+// stored blocks from genesis, validating each against the indexes rebuilt so
+// far, and calls progress, if not nil, after each block. If it is interrupted,
+// calling it again resumes from the last block it finished; until then the
+// chain refuses to open with ErrReindexing. It returns the number of blocks
+// in the chain.
+//
+// If a block is invalid, the chain is cut back to the block before it, which
+// becomes the tip; the blocks from the invalid one on are left unindexed, and
+// the error, wrapping ErrCorruptBlock, names the block. The number returned
+// is then that of the valid blocks kept.
+func ReindexBlockchain(cfg Config, progress func(height, total int)) (int, error) {
+	if cfg.InMemory || !ChainExists(cfg) {
+		return 0, ErrChainNotFound
+	}
+	db, err := cfg.openDB()
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	version, err := formatVersion(db)
+	if err != nil {
+		return 0, err
+	}
+	if version != dbFormatVersion {
+		return 0, fmt.Errorf("%w: storage format %d, expected %d", ErrNeedsMigration, version, dbFormatVersion)
+	}
+	hashes, err := chainHashes(db)
+	if err != nil {
+		return 0, err
+	}
+	err = checkBodies(db, hashes)
+	if err != nil {
+		return 0, fmt.Errorf("can't reindex a pruned chain: %w", err)
+	}
+
+	start, err := reindexProgress(db)
+	if err != nil {
+		return 0, err
+	}
+	if start > len(hashes) {
+		return 0, fmt.Errorf("%w: reindex progress %d is past the tip at height %d", ErrCorruptBlock, start, len(hashes))
+	}
+	if start > 0 {
+		fmt.Printf("Resuming the reindex at block %d of %d\n", start+1, len(hashes))
+	} else {
+		err := clearIndexes(db)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// The UTXO cache is left off: blocks are connected straight to the
+	// database, and the reads validation makes must see them.
+	cfg.Cache.UTXOs = -1
+	var tip []byte
+	if start > 0 {
+		tip = hashes[start-1]
+	}
+	bc := newBlockchain(db, tip, cfg)
+	bc.legacyBlocks, err = getCount(db, dbLegacyBlocksKey)
+	if err != nil {
+		return 0, err
+	}
+	for height := start; height < len(hashes); height++ {
+		hash := hashes[height]
+		block, err := getBlock(db, hash)
+		if err != nil {
+			return 0, readError(hash, err)
+		}
+		err = bc.validateBlock(block)
+		if err != nil {
+			invalid := fmt.Errorf("%w: block %d (%x) is invalid: %w", ErrCorruptBlock, height+1, hash, err)
+			err := truncateChain(db, hashes[:height])
+			if err != nil {
+				return 0, err
+			}
+			return height, fmt.Errorf("%w; the chain now ends at block %d and the %d blocks from it on are no longer part of it", invalid, height, len(hashes)-height)
+		}
+		err = db.Batch(func(b storage.Batch) error {
+			err := putChainWork(b, block)
+			if err != nil {
+				return err
+			}
+			err = connectUTXOs(b, block, height)
+			if err != nil {
+				return err
+			}
+			err = b.Put([]byte(dbUTXOTipKey), hash)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(dbReindexKey), binary.AppendUvarint(nil, uint64(height+1)))
+		})
+		if err != nil {
+			return 0, err
+		}
+		err = bc.fail(FailAfterCommit)
+		if err != nil {
+			return 0, err
+		}
+		bc.lastHash = hash
+		if progress != nil {
+			progress(height+1, len(hashes))
+		}
+	}
+	return len(hashes), db.Delete([]byte(dbReindexKey))
+}
+
+// truncateChain ends the reindex at the last of valid, whose indexes are
+// already rebuilt, making it the tip. With no valid block the chain has no
+// tip left, like one whose creation was interrupted.
+func truncateChain(db storage.Store, valid [][]byte) error {
+	return db.Batch(func(b storage.Batch) error {
+		var err error
+		if len(valid) == 0 {
+			err = b.Delete([]byte(dbLastHashKey))
+		} else {
+			err = b.Put([]byte(dbLastHashKey), valid[len(valid)-1])
+		}
+		if err != nil {
+			return err
+		}
+		return b.Delete([]byte(dbReindexKey))
+	})
+}
+
+// reindexProgress returns the number of blocks an interrupted reindex
+// processed, or 0 if there is none.
+func reindexProgress(db storage.Reader) (int, error) {
+	return getCount(db, dbReindexKey)
+}
+
+// getCount returns the uvarint stored under key, or 0 if it is not set.
+func getCount(r storage.Reader, key string) (int, error) {
+	val, err := getKey(r, key)
+	if err != nil || val == nil {
+		return 0, err
+	}
+	n, size := binary.Uvarint(val)
+	if size <= 0 || size != len(val) {
+		return 0, fmt.Errorf("%w: %s is %x", ErrCorruptBlock, key, val)
+	}
+	return int(n), nil
+}
+
+// clearIndexes marks a reindex as started and deletes the chainwork and UTXO
+// set. An interruption here leaves the progress at 0, so the next attempt
+// clears them again.
+func clearIndexes(db storage.Store) error {
+	err := db.Put([]byte(dbReindexKey), binary.AppendUvarint(nil, 0))
+	if err != nil {
+		return err
+	}
+	err = db.Delete([]byte(dbUTXOTipKey))
+	if err != nil {
+		return err
+	}
+	for _, prefix := range []byte{chainWorkKeyPrefix, utxoKeyPrefix} {
+		var keys [][]byte
+		err := db.Iterate([]byte{prefix}, func(key, _ []byte) error {
+			keys = append(keys, append([]byte(nil), key...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		err = deleteKeys(db, keys)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
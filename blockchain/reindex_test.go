@@ -0,0 +1,101 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+func TestReindexInvalidBlock(t *testing.T) {
+	cfg := Config{Params: &RegTestParams, DBPath: filepath.Join(t.TempDir(), "blocks")}
+	w, err := wallet.NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := string(w.GetAddress())
+	bc, err := CreateBlockchain(address, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.Generate(2, address); err != nil {
+		t.Fatal(err)
+	}
+
+	// Store a block whose coinbase pays twice the reward, bypassing
+	// validation, then mine a valid block on top of it.
+	coinbase, err := NewCoinbaseTX(address, "", RegTestParams.Bech32HRP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase.Vout[0].Value = 2 * blockReward
+	coinbase.SetID()
+	bits, err := bc.NextBits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := NewBlock([]*Transaction{coinbase}, bc.Tip(), bits, bc.now().Unix()+1)
+	bc.CloseDB()
+	db, err := cfg.openDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Batch(func(b storage.Batch) error { return connectBlock(b, bad, 3) })
+	_ = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc, err = LoadBlockchain(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.Generate(1, address); err != nil {
+		t.Fatal(err)
+	}
+	bc.CloseDB()
+
+	n, err := ReindexBlockchain(cfg, nil)
+	if !errors.Is(err, ErrCorruptBlock) {
+		t.Fatalf("reindex: got %v, want ErrCorruptBlock", err)
+	}
+	if n != 3 {
+		t.Errorf("reindex kept %d blocks, want 3", n)
+	}
+
+	// The chain now ends at the last valid block and can be extended.
+	bc, err = LoadBlockchain(cfg)
+	if err != nil {
+		t.Fatalf("opening the chain after a failed reindex: %v", err)
+	}
+	if tip := bc.Tip(); !bytes.Equal(tip, bad.PrevBlockHash) {
+		t.Errorf("tip is %x, want the block before the invalid one, %x", tip, bad.PrevBlockHash)
+	}
+	balance := func() int {
+		utxos, err := bc.FindUTXO(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, out := range utxos {
+			total += out.Value
+		}
+		return total
+	}
+	if got, want := balance(), 3*blockReward; got != want {
+		t.Errorf("balance after reindex = %d, want %d", got, want)
+	}
+	if _, err := bc.Generate(1, address); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := balance(), 4*blockReward; got != want {
+		t.Errorf("balance after mining = %d, want %d", got, want)
+	}
+	bc.CloseDB()
+
+	if n, err := ReindexBlockchain(cfg, nil); err != nil || n != 4 {
+		t.Errorf("reindexing the repaired chain: got %d, %v, want 4 blocks", n, err)
+	}
+}
@@ -0,0 +1,249 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The canonical encoding is built from three primitives: unsigned varints,
+// zig-zag signed varints and varint-length-prefixed byte strings. Every
+// encoded block and transaction starts with its version so the format can
+// evolve without reinterpreting old data.
+//
+//	transaction: version | len(vin)  | vin...  | len(vout) | vout...
+//	input:       txid (bytes) | vout (varint) | signature (bytes) |
+//	             pubkey (bytes)
+//	output:      value (varint) | script (bytes)
+//	header:      version | prev hash (bytes) | merkle root (bytes) |
+//	             timestamp (varint) | bits (uvarint) | nonce (uvarint)
+//	body:        len(txs) | txs...
+//	block:       header | body
+//
+// Derived fields (transaction IDs and block hashes) are never stored; they are
+// recomputed from the encoding when it is decoded.
+const (
+	blockVersion = 1
+	txVersion    = 1
+	// legacyBlockVersion marks blocks converted from the gob format by
+	// MigrateGobDB. Their inputs were never signed, so they are only
+	// accepted when reindexing the chain they were migrated into, up to the
+	// height it recorded in dbLegacyBlocksKey.
+	legacyBlockVersion = 0
+)
+
+var errTruncated = errors.New("unexpected end of data")
+
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) varint(v int64) {
+	e.buf = binary.AppendVarint(e.buf, v)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uvarint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = errTruncated
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.data)) {
+		d.err = errTruncated
+		return nil
+	}
+	b := make([]byte, n)
+	copy(b, d.data[:n])
+	d.data = d.data[n:]
+	return b
+}
+
+// count reads a collection length, rejecting values that could not possibly
+// fit in the remaining data so corrupt input can't force a huge allocation.
+func (d *decoder) count() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.err = errTruncated
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) finish() error {
+	if d.err == nil && len(d.data) != 0 {
+		d.err = fmt.Errorf("%d trailing bytes", len(d.data))
+	}
+	return d.err
+}
+
+func (tx *Transaction) encode(e *encoder) {
+	e.uvarint(uint64(tx.Version))
+	e.uvarint(uint64(len(tx.Vin)))
+	for _, in := range tx.Vin {
+		e.bytes(in.Txid)
+		e.varint(int64(in.Vout))
+		e.bytes(in.Signature)
+		e.bytes(in.PubKey)
+	}
+	e.uvarint(uint64(len(tx.Vout)))
+	for _, out := range tx.Vout {
+		e.varint(int64(out.Value))
+		e.bytes(out.ScriptPubKey)
+	}
+}
+
+func decodeTransaction(d *decoder) *Transaction {
+	tx := &Transaction{Version: int(d.uvarint())}
+	if d.err == nil && tx.Version != txVersion {
+		d.err = fmt.Errorf("unsupported transaction version %d", tx.Version)
+		return nil
+	}
+	for i, n := 0, d.count(); i < n; i++ {
+		tx.Vin = append(tx.Vin, TXInput{
+			Txid:      d.bytes(),
+			Vout:      int(d.varint()),
+			Signature: d.bytes(),
+			PubKey:    d.bytes(),
+		})
+	}
+	for i, n := 0, d.count(); i < n; i++ {
+		tx.Vout = append(tx.Vout, TXOutput{
+			Value:        int(d.varint()),
+			ScriptPubKey: d.bytes(),
+		})
+	}
+	if d.err != nil {
+		return nil
+	}
+	tx.SetID()
+	return tx
+}
+
+// Serialize returns the canonical encoding of the transaction.
+func (tx *Transaction) Serialize() []byte {
+	var e encoder
+	tx.encode(&e)
+	return e.buf
+}
+
+func DeserializeTransaction(data []byte) (*Transaction, error) {
+	d := decoder{data: data}
+	tx := decodeTransaction(&d)
+	if err := d.finish(); err != nil {
+		return nil, fmt.Errorf("decoding transaction: %w", err)
+	}
+	return tx, nil
+}
+
+func (h *BlockHeader) encode(e *encoder) {
+	e.uvarint(uint64(h.Version))
+	e.bytes(h.PrevBlockHash)
+	e.bytes(h.MerkleRoot)
+	e.varint(h.Timestamp)
+	e.uvarint(uint64(h.Bits))
+	e.uvarint(uint64(h.Nonce))
+}
+
+func (h *BlockHeader) decode(d *decoder) {
+	h.Version = int(d.uvarint())
+	if d.err == nil && h.Version != blockVersion && h.Version != legacyBlockVersion {
+		d.err = fmt.Errorf("unsupported block version %d", h.Version)
+		return
+	}
+	h.PrevBlockHash = d.bytes()
+	h.MerkleRoot = d.bytes()
+	h.Timestamp = d.varint()
+	h.Bits = uint32(d.uvarint())
+	h.Nonce = int(d.uvarint())
+}
+
+func encodeBody(e *encoder, transactions []*Transaction) {
+	e.uvarint(uint64(len(transactions)))
+	for _, tx := range transactions {
+		tx.encode(e)
+	}
+}
+
+func decodeBody(d *decoder) []*Transaction {
+	var transactions []*Transaction
+	for i, n := 0, d.count(); i < n; i++ {
+		transactions = append(transactions, decodeTransaction(d))
+	}
+	return transactions
+}
+
+func decodeHeader(data []byte) (*BlockHeader, error) {
+	d := decoder{data: data}
+	header := &BlockHeader{}
+	header.decode(&d)
+	if err := d.finish(); err != nil {
+		return nil, fmt.Errorf("%w: decoding header: %w", ErrCorruptBlock, err)
+	}
+	return header, nil
+}
+
+func decodeBlock(data []byte) (*Block, error) {
+	d := decoder{data: data}
+	block := &Block{}
+	block.BlockHeader.decode(&d)
+	block.Transactions = decodeBody(&d)
+	if err := d.finish(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCorruptBlock, err)
+	}
+	block.Hash = block.BlockHeader.Hash()
+	return block, nil
+}
+
+func serializeBody(transactions []*Transaction) []byte {
+	var e encoder
+	encodeBody(&e, transactions)
+	return e.buf
+}
+
+func deserializeBody(data []byte) ([]*Transaction, error) {
+	d := decoder{data: data}
+	transactions := decodeBody(&d)
+	if err := d.finish(); err != nil {
+		return nil, fmt.Errorf("%w: decoding body: %w", ErrCorruptBlock, err)
+	}
+	return transactions, nil
+}
@@ -0,0 +1,182 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+// signatureHash returns the digest input i signs: the transaction with every
+// signature and public key cleared, except that input i carries the locking
+// script of the output it spends.
+func (tx *Transaction) signatureHash(i int, prevOut TXOutput) []byte {
+	txCopy := Transaction{Version: tx.Version, Vout: tx.Vout}
+	for _, in := range tx.Vin {
+		txCopy.Vin = append(txCopy.Vin, TXInput{Txid: in.Txid, Vout: in.Vout})
+	}
+	txCopy.Vin[i].PubKey = prevOut.ScriptPubKey
+
+	hash := sha256.Sum256(txCopy.Serialize())
+	return hash[:]
+}
+
+// Sign signs every input with the wallet key its previous output is locked
+// to. prevOuts maps the outpoint of each input to the output it spends.
+func (tx *Transaction) Sign(wallets *wallet.Wallets, prevOuts map[string]TXOutput) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+
+	for i, in := range tx.Vin {
+		prevOut, ok := prevOuts[in.Outpoint().String()]
+		if !ok {
+			return fmt.Errorf("input %d: previous output %s not found", i, in.Outpoint())
+		}
+		w := wallets.FindByPubKeyHash(prevOut.ScriptPubKey)
+		if w == nil || w.WatchOnly {
+			return fmt.Errorf("input %d: no key for %s", i, wallet.PubKeyHashToAddress(prevOut.ScriptPubKey))
+		}
+
+		r, s, err := ecdsa.Sign(rand.Reader, &w.PrivateKey, tx.signatureHash(i, prevOut))
+		if err != nil {
+			return err
+		}
+		tx.Vin[i].Signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		tx.Vin[i].PubKey = w.PublicKey
+	}
+	tx.SetID()
+	return nil
+}
+
+// Verify checks that every input is signed by the key its previous output
+// is locked to, that no output is spent twice and that the transaction does
+// not spend more than its inputs.
+func (tx *Transaction) Verify(prevOuts map[string]TXOutput) error {
+	return tx.verify(prevOuts, true)
+}
+
+// verify is Verify, leaving out the signature checks if checkSignatures is
+// false.
+func (tx *Transaction) verify(prevOuts map[string]TXOutput, checkSignatures bool) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	if err := addSpends(make(map[string][]byte), tx); err != nil {
+		return err
+	}
+
+	inputValue := 0
+	for i, in := range tx.Vin {
+		prevOut, ok := prevOuts[in.Outpoint().String()]
+		if !ok {
+			return fmt.Errorf("input %d: previous output %s not found", i, in.Outpoint())
+		}
+		if !bytes.Equal(wallet.HashPubKey(in.PubKey), prevOut.ScriptPubKey) {
+			return fmt.Errorf("input %d: public key does not match %s", i, in.Outpoint())
+		}
+		if checkSignatures {
+			if len(in.Signature) != 64 {
+				return fmt.Errorf("input %d: missing or malformed signature", i)
+			}
+			r := new(big.Int).SetBytes(in.Signature[:32])
+			s := new(big.Int).SetBytes(in.Signature[32:])
+			pubKey := wallet.PublicKeyFromBytes(in.PubKey)
+			if !ecdsa.Verify(&pubKey, tx.signatureHash(i, prevOut), r, s) {
+				return fmt.Errorf("input %d: invalid signature", i)
+			}
+		}
+		if prevOut.Value < 0 || prevOut.Value > MaxMoney-inputValue {
+			return fmt.Errorf("input %d: value out of range", i)
+		}
+		inputValue += prevOut.Value
+	}
+
+	outputValue := 0
+	for _, out := range tx.Vout {
+		if out.Value <= 0 {
+			return errors.New("output value must be positive")
+		}
+		if out.Value > MaxMoney-outputValue {
+			return fmt.Errorf("outputs total more than %d", MaxMoney)
+		}
+		outputValue += out.Value
+	}
+	if outputValue > inputValue {
+		return fmt.Errorf("outputs total %d but inputs only %d", outputValue, inputValue)
+	}
+	return nil
+}
+
+// FindTransaction returns the transaction with the given ID.
+func (bc *Blockchain) FindTransaction(id []byte) (*Transaction, error) {
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+		if block == nil {
+			break
+		}
+		for _, tx := range block.Transactions {
+			if bytes.Equal(tx.ID, id) {
+				return tx, nil
+			}
+		}
+	}
+	if err := bci.Err(); err != nil {
+		if errors.Is(err, ErrPruned) {
+			return nil, fmt.Errorf("transaction %x not found in the blocks kept: %w", id, err)
+		}
+		return nil, err
+	}
+	return nil, fmt.Errorf("transaction %x not found", id)
+}
+
+// PrevOutputs looks up the output spent by each input of tx, in the UTXO set
+// if it is unspent and otherwise in the transaction that created it.
+func (bc *Blockchain) PrevOutputs(tx *Transaction) (map[string]TXOutput, error) {
+	prevOuts, err := bc.spentOutputs(tx)
+	if err == nil {
+		return prevOuts, nil
+	}
+	prevOuts = make(map[string]TXOutput)
+	for _, in := range tx.Vin {
+		prevTX, err := bc.FindTransaction(in.Txid)
+		if err != nil {
+			return nil, err
+		}
+		if in.Vout < 0 || in.Vout >= len(prevTX.Vout) {
+			return nil, fmt.Errorf("transaction %x has no output %d", in.Txid, in.Vout)
+		}
+		prevOuts[in.Outpoint().String()] = prevTX.Vout[in.Vout]
+	}
+	return prevOuts, nil
+}
+
+// SignTransaction signs tx with keys from wallets, looking up the outputs it
+// spends in the chain.
+func (bc *Blockchain) SignTransaction(tx *Transaction, wallets *wallet.Wallets) error {
+	prevOuts, err := bc.PrevOutputs(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Sign(wallets, prevOuts)
+}
+
+// VerifyTransaction verifies tx against the outputs it spends, which must all
+// be unspent at the tip.
+func (bc *Blockchain) VerifyTransaction(tx *Transaction) error {
+	return bc.verifyTransaction(tx, true)
+}
+
+func (bc *Blockchain) verifyTransaction(tx *Transaction, checkSignatures bool) error {
+	prevOuts, err := bc.spentOutputs(tx)
+	if err != nil {
+		return err
+	}
+	return tx.verify(prevOuts, checkSignatures)
+}
@@ -4,63 +4,122 @@ import (
 	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
-	"encoding/gob"
 	"encoding/hex"
 	"fmt"
-	"log"
+	"strconv"
 	"strings"
 
-	"github.com/Triad-0112/BlockChain.git/utils"
 	"github.com/Triad-0112/BlockChain.git/wallet"
 )
 
+// MaxMoney is the most any output, or the outputs or inputs of a transaction
+// together, may be worth.
+const MaxMoney = 21_000_000 * 100_000_000
+
 type TXOutput struct {
 	Value        int
 	ScriptPubKey []byte
 }
 
 type TXInput struct {
-	Txid   []byte
-	Vout   int
-	PubKey []byte
+	Txid      []byte
+	Vout      int
+	Signature []byte
+	PubKey    []byte
+}
+
+// Outpoint identifies the output of a transaction that an input spends.
+type Outpoint struct {
+	Txid []byte
+	Vout int
+}
+
+func (o Outpoint) String() string {
+	return fmt.Sprintf("%x:%d", o.Txid, o.Vout)
+}
+
+// ParseOutpoint parses the "txid:vout" form produced by Outpoint.String.
+func ParseOutpoint(s string) (Outpoint, error) {
+	txid, vout, ok := strings.Cut(s, ":")
+	if !ok {
+		return Outpoint{}, fmt.Errorf("outpoint %q is not of the form txid:vout", s)
+	}
+	id, err := hex.DecodeString(txid)
+	if err != nil {
+		return Outpoint{}, fmt.Errorf("outpoint %q: %w", s, err)
+	}
+	index, err := strconv.Atoi(vout)
+	if err != nil {
+		return Outpoint{}, fmt.Errorf("outpoint %q: %w", s, err)
+	}
+	return Outpoint{id, index}, nil
+}
+
+func (in *TXInput) Outpoint() Outpoint {
+	return Outpoint{in.Txid, in.Vout}
 }
 
 type Transaction struct {
-	ID   []byte
-	Vin  []TXInput
-	Vout []TXOutput
+	Version int
+	ID      []byte
+	Vin     []TXInput
+	Vout    []TXOutput
+}
+
+func (tx *Transaction) clone() *Transaction {
+	c := &Transaction{Version: tx.Version, ID: bytes.Clone(tx.ID)}
+	c.Vin = make([]TXInput, len(tx.Vin))
+	for i, in := range tx.Vin {
+		c.Vin[i] = TXInput{bytes.Clone(in.Txid), in.Vout, bytes.Clone(in.Signature), bytes.Clone(in.PubKey)}
+	}
+	c.Vout = make([]TXOutput, len(tx.Vout))
+	for i, out := range tx.Vout {
+		c.Vout[i] = TXOutput{out.Value, bytes.Clone(out.ScriptPubKey)}
+	}
+	return c
 }
 
+// SetID sets the transaction ID to the hash of its canonical encoding.
 func (tx *Transaction) SetID() {
-	var encoded bytes.Buffer
-	var hash [32]byte
+	hash := sha256.Sum256(tx.Serialize())
+	tx.ID = hash[:]
+}
+
+// blockReward is the most the coinbase of a block may pay out.
+const blockReward = 100
 
-	enc := gob.NewEncoder(&encoded)
-	err := enc.Encode(tx)
+// NewCoinbaseTX returns a coinbase paying the block reward to to, which if
+// bech32 must be under hrp.
+func NewCoinbaseTX(to, data, hrp string) (*Transaction, error) {
+	txout := TXOutput{blockReward, nil}
+	err := txout.Lock([]byte(to), hrp)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
-	hash = sha256.Sum256(encoded.Bytes())
-	tx.ID = hash[:]
+	tx := Transaction{txVersion, nil, []TXInput{coinbaseInput(data)}, []TXOutput{txout}}
+	tx.SetID()
+
+	return &tx, nil
+}
+
+// newEmptyCoinbase returns a coinbase carrying data that claims no reward, for
+// blocks mined without one.
+func newEmptyCoinbase(data string) *Transaction {
+	tx := Transaction{txVersion, nil, []TXInput{coinbaseInput(data)}, nil}
+	tx.SetID()
+	return &tx
 }
 
-func NewCoinbaseTX(to, data string) *Transaction {
+// coinbaseInput returns the input of a coinbase carrying data, or random data
+// if it is empty so that the coinbase gets an ID of its own.
+func coinbaseInput(data string) TXInput {
 	if data == "" {
+		// crypto/rand.Read never fails; it crashes the program instead.
 		randData := make([]byte, 20)
-		_, err := rand.Read(randData)
-		if err != nil {
-			log.Panic(err)
-		}
+		_, _ = rand.Read(randData)
 		data = fmt.Sprintf("%x", randData)
 	}
-
-	txin := TXInput{[]byte{}, -1, []byte(data)}
-	txout := TXOutput{100, nil}
-	txout.Lock([]byte(to))
-	tx := Transaction{nil, []TXInput{txin}, []TXOutput{txout}}
-	tx.SetID()
-
-	return &tx
+	return TXInput{[]byte{}, -1, nil, []byte(data)}
 }
 
 func (in *TXInput) CanUnlockOutputWith(pubKeyHash []byte) bool {
@@ -76,52 +135,182 @@ func (tx *Transaction) IsCoinbase() bool {
 	return len(tx.Vin) == 1 && len(tx.Vin[0].Txid) == 0 && tx.Vin[0].Vout == -1
 }
 
-func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) (*Transaction, error) {
+// SendOptions controls which outputs NewUTXOTransaction spends.
+type SendOptions struct {
+	// Strategy picks outputs automatically; DefaultCoinSelector if nil.
+	Strategy CoinSelector
+	// Inputs, when set, are spent exactly as given instead of letting
+	// Strategy choose.
+	Inputs []Outpoint
+}
+
+// Payment is one recipient of a transaction.
+type Payment struct {
+	Address string
+	Amount  int
+}
+
+func NewUTXOTransaction(wallets *wallet.Wallets, from, to string, amount int, bc *Blockchain, opts SendOptions) (*Transaction, error) {
+	return NewBatchTransaction(wallets, from, []Payment{{to, amount}}, bc, opts)
+}
+
+// NewBatchTransaction builds and signs a single transaction paying every
+// payment from the outputs of from and its change addresses. Any change goes
+// to a fresh change address added to wallets, which the caller must save
+// before the transaction is broadcast.
+func NewBatchTransaction(wallets *wallet.Wallets, from string, payments []Payment, bc *Blockchain, opts SendOptions) (*Transaction, error) {
+	w, ok := wallets.Wallets[from]
+	if !ok {
+		return nil, fmt.Errorf("address %s is not in the wallet", from)
+	}
+	if w.WatchOnly {
+		return nil, fmt.Errorf("address %s is watch-only and can't be spent from", from)
+	}
+	return newPayment(wallets, wallets.OwnedAddresses(from), from, payments, bc, opts)
+}
+
+// NewAccountTransaction is like NewBatchTransaction but spends from any
+// address in account. Change is owned by the account's first address.
+func NewAccountTransaction(wallets *wallet.Wallets, account string, payments []Payment, bc *Blockchain, opts SendOptions) (*Transaction, error) {
+	var addresses []string
+	owner := ""
+	for _, address := range wallets.AccountAddresses(account) {
+		w := wallets.Wallets[address]
+		if w.WatchOnly {
+			continue
+		}
+		addresses = append(addresses, address)
+		if owner == "" && !w.Internal {
+			owner = address
+		}
+	}
+	if owner == "" {
+		return nil, fmt.Errorf("account %q has no spendable addresses", account)
+	}
+	return newPayment(wallets, addresses, owner, payments, bc, opts)
+}
+
+// newPayment builds and signs a transaction paying payments from the outputs
+// of addresses, sending change to a new change address owned by changeOwner.
+func newPayment(wallets *wallet.Wallets, addresses []string, changeOwner string, payments []Payment, bc *Blockchain, opts SendOptions) (*Transaction, error) {
 	var inputs []TXInput
 	var outputs []TXOutput
 
-	wallets, err := wallet.NewWallets()
-	if err != nil {
-		return nil, err
+	var utxos []UTXO
+	for _, address := range addresses {
+		found, err := bc.FindUnspentOutputs(wallets.Wallets[address].PubKeyHash())
+		if err != nil {
+			return nil, err
+		}
+		utxos = append(utxos, found...)
 	}
-	w := wallets.GetWallet(from)
-	pubKeyHash := wallet.HashPubKey(w.PublicKey)
 
-	acc, validOutputs := bc.FindSpendableOutputs(pubKeyHash, amount)
+	amount := 0
+	for _, payment := range payments {
+		if payment.Amount <= 0 {
+			return nil, fmt.Errorf("amount for %s must be positive", payment.Address)
+		}
+		out, err := NewTXOutput(payment.Amount, payment.Address, bc.params.Bech32HRP)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *out)
+		amount += payment.Amount
+	}
 
-	if acc < amount {
-		log.Panic("ERROR: Not enough funds")
+	selected, err := selectCoins(utxos, amount, opts)
+	if err != nil {
+		return nil, err
 	}
+	acc := sumUTXOs(selected)
 
-	for txid, outs := range validOutputs {
-		txID, err := hex.DecodeString(txid)
+	for _, utxo := range selected {
+		input := TXInput{utxo.Txid, utxo.Vout, nil, nil}
+		inputs = append(inputs, input)
+	}
+	if acc > amount {
+		changeAddress, err := wallets.NewChangeAddress(changeOwner)
 		if err != nil {
 			return nil, err
 		}
-		for _, out := range outs {
-			input := TXInput{txID, out, w.PublicKey}
-			inputs = append(inputs, input)
+		changeOut, err := NewTXOutput(acc-amount, changeAddress, bc.params.Bech32HRP)
+		if err != nil {
+			return nil, err
 		}
-	}
-	out := TXOutput{amount, nil}
-	out.Lock([]byte(to))
-	outputs = append(outputs, out)
-	if acc > amount {
-		changeOut := TXOutput{acc - amount, nil}
-		changeOut.Lock([]byte(from))
-		outputs = append(outputs, changeOut)
+		outputs = append(outputs, *changeOut)
 	}
 
-	tx := Transaction{nil, inputs, outputs}
+	tx := Transaction{txVersion, nil, inputs, outputs}
 	tx.SetID()
+	err = bc.SignTransaction(&tx, wallets)
+	if err != nil {
+		return nil, err
+	}
 
 	return &tx, nil
 }
 
-func (out *TXOutput) Lock(address []byte) {
-	pubKeyHash := utils.Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-4]
+// selectCoins picks the outputs to spend from utxos, either the ones named in
+// opts.Inputs or those chosen by opts.Strategy.
+func selectCoins(utxos []UTXO, amount int, opts SendOptions) ([]UTXO, error) {
+	if len(opts.Inputs) == 0 {
+		strategy := opts.Strategy
+		if strategy == nil {
+			strategy = DefaultCoinSelector
+		}
+		return strategy(utxos, amount)
+	}
+
+	available := make(map[string]UTXO)
+	for _, utxo := range utxos {
+		available[utxo.Outpoint.String()] = utxo
+	}
+	var selected []UTXO
+	for _, outpoint := range opts.Inputs {
+		utxo, ok := available[outpoint.String()]
+		if !ok {
+			return nil, fmt.Errorf("output %s is not an unspent output of the sender", outpoint)
+		}
+		delete(available, outpoint.String())
+		selected = append(selected, utxo)
+	}
+	if sumUTXOs(selected) < amount {
+		return nil, insufficientFunds(selected, amount)
+	}
+	return selected, nil
+}
+
+// NewRawTransaction builds an unsigned transaction spending exactly the given
+// outpoints into the given outputs.
+func NewRawTransaction(inputs []Outpoint, outputs []TXOutput) *Transaction {
+	tx := Transaction{Version: txVersion, Vout: outputs}
+	for _, in := range inputs {
+		tx.Vin = append(tx.Vin, TXInput{Txid: in.Txid, Vout: in.Vout})
+	}
+	tx.SetID()
+	return &tx
+}
+
+// NewTXOutput returns an output of value locked to address, which if bech32
+// must be under hrp.
+func NewTXOutput(value int, address, hrp string) (*TXOutput, error) {
+	out := &TXOutput{value, nil}
+	err := out.Lock([]byte(address), hrp)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Lock locks the output to address, failing with ErrInvalidAddress if the
+// address does not decode or is bech32 under a prefix other than hrp.
+func (out *TXOutput) Lock(address []byte, hrp string) error {
+	pubKeyHash, err := wallet.AddressToPubKeyHash(string(address), hrp)
+	if err != nil {
+		return err
+	}
 	out.ScriptPubKey = pubKeyHash
+	return nil
 }
 
 func (tx *Transaction) String() string {
@@ -133,6 +322,7 @@ func (tx *Transaction) String() string {
 		lines = append(lines, fmt.Sprintf("     Input %d:", i))
 		lines = append(lines, fmt.Sprintf("       TXID:      %x", input.Txid))
 		lines = append(lines, fmt.Sprintf("       Out:       %d", input.Vout))
+		lines = append(lines, fmt.Sprintf("       Signature: %x", input.Signature))
 		lines = append(lines, fmt.Sprintf("       PublicKey: %x", input.PubKey))
 	}
 
@@ -0,0 +1,318 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+)
+
+// The UTXO set holds every unspent output under utxoKeyPrefix, the ID of the
+// transaction that created it and its index as a big-endian uint32. It lets
+// transactions be verified without the bodies of the blocks they spend from.
+// Changes made by new blocks are held in the UTXO cache and written out in
+// bulk; dbUTXOTipKey records which block the set in the database matches.
+//
+//	entry: height (uvarint) | tx index in block (uvarint) | output
+//
+// The height and index only serve to list outputs in chain order.
+const utxoKeyPrefix = 'u'
+
+// dbUTXOTipKey holds the hash of the block the UTXO set in the database is up
+// to date with. It lags the tip while changes are held in the cache, and
+// when the chain is opened the blocks after it are connected to the set again.
+// It must not start with utxoKeyPrefix.
+const dbUTXOTipKey = "ot"
+
+type utxoEntry struct {
+	UTXO
+	height  int
+	txIndex int
+}
+
+func utxoKey(outpoint Outpoint) []byte {
+	key := append([]byte{utxoKeyPrefix}, outpoint.Txid...)
+	return binary.BigEndian.AppendUint32(key, uint32(outpoint.Vout))
+}
+
+func encodeUTXOEntry(height, txIndex int, out TXOutput) []byte {
+	var e encoder
+	e.uvarint(uint64(height))
+	e.uvarint(uint64(txIndex))
+	e.varint(int64(out.Value))
+	e.bytes(out.ScriptPubKey)
+	return e.buf
+}
+
+func decodeUTXOEntry(key, val []byte) (utxoEntry, error) {
+	if len(key) < 5 {
+		return utxoEntry{}, fmt.Errorf("%w: UTXO key %x is too short", ErrCorruptBlock, key)
+	}
+	d := decoder{data: val}
+	entry := utxoEntry{height: int(d.uvarint()), txIndex: int(d.uvarint())}
+	entry.Output = TXOutput{Value: int(d.varint()), ScriptPubKey: d.bytes()}
+	if err := d.finish(); err != nil {
+		return utxoEntry{}, fmt.Errorf("%w: decoding UTXO %x: %w", ErrCorruptBlock, key, err)
+	}
+	txid := key[1 : len(key)-4]
+	entry.Outpoint = Outpoint{
+		Txid: append([]byte(nil), txid...),
+		Vout: int(binary.BigEndian.Uint32(key[len(key)-4:])),
+	}
+	return entry, nil
+}
+
+// connectUTXOs spends the outputs consumed by block and adds the ones it
+// creates. height is the number of blocks before it.
+func connectUTXOs(b storage.Batch, block *Block, height int) error {
+	for i, tx := range block.Transactions {
+		if !tx.IsCoinbase() {
+			for _, in := range tx.Vin {
+				if err := b.Delete(utxoKey(in.Outpoint())); err != nil {
+					return err
+				}
+			}
+		}
+		for vout, out := range tx.Vout {
+			key := utxoKey(Outpoint{tx.ID, vout})
+			if err := b.Put(key, encodeUTXOEntry(height, i, out)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (bc *Blockchain) getUTXO(outpoint Outpoint) (TXOutput, bool, error) {
+	key := utxoKey(outpoint)
+	val, err := bc.utxoCache.get(bc.db, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return TXOutput{}, false, nil
+	}
+	if err != nil {
+		return TXOutput{}, false, err
+	}
+	entry, err := decodeUTXOEntry(key, val)
+	return entry.Output, err == nil, err
+}
+
+// spentOutputs looks up the output spent by each input of tx in the UTXO set.
+// It fails if any of them is missing or already spent.
+func (bc *Blockchain) spentOutputs(tx *Transaction) (map[string]TXOutput, error) {
+	prevOuts := make(map[string]TXOutput)
+	if tx.IsCoinbase() {
+		return prevOuts, nil
+	}
+	for _, in := range tx.Vin {
+		out, ok, err := bc.getUTXO(in.Outpoint())
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w %s", ErrMissingOutput, in.Outpoint())
+		}
+		prevOuts[in.Outpoint().String()] = out
+	}
+	return prevOuts, nil
+}
+
+// checkNewID fails with ErrDuplicateTransaction if a transaction with the ID
+// of tx still has unspent outputs.
+func (bc *Blockchain) checkNewID(tx *Transaction) error {
+	for vout := range tx.Vout {
+		_, ok, err := bc.getUTXO(Outpoint{tx.ID, vout})
+		if err != nil {
+			return err
+		}
+		if ok {
+			return fmt.Errorf("%w: %x", ErrDuplicateTransaction, tx.ID)
+		}
+	}
+	return nil
+}
+
+// addSpends records in spent, which maps outpoints to the ID of the
+// transaction spending them, the outpoints tx spends. It fails with
+// ErrDoubleSpend, leaving the outpoints recorded so far, if one of them is
+// already there.
+func addSpends(spent map[string][]byte, tx *Transaction) error {
+	if tx.IsCoinbase() {
+		return nil
+	}
+	for _, in := range tx.Vin {
+		outpoint := in.Outpoint().String()
+		if other, ok := spent[outpoint]; ok {
+			if bytes.Equal(other, tx.ID) {
+				return fmt.Errorf("%w of %s: transaction %x spends it twice", ErrDoubleSpend, outpoint, tx.ID)
+			}
+			return fmt.Errorf("%w of %s: transactions %x and %x both spend it", ErrDoubleSpend, outpoint, other, tx.ID)
+		}
+		spent[outpoint] = tx.ID
+	}
+	return nil
+}
+
+// FindUnspentOutputs returns every unspent output locked to pubKeyHash,
+// newest first.
+func (bc *Blockchain) FindUnspentOutputs(pubKeyHash []byte) ([]UTXO, error) {
+	var entries []utxoEntry
+	add := func(key, val []byte) error {
+		entry, err := decodeUTXOEntry(key, val)
+		if err != nil {
+			return err
+		}
+		if entry.Output.CanBeUnlockedWith(pubKeyHash) {
+			entries = append(entries, entry)
+		}
+		return nil
+	}
+	// Changes still in the cache take the place of what the database has.
+	pending := bc.utxoCache.pending()
+	err := bc.db.Iterate([]byte{utxoKeyPrefix}, func(key, val []byte) error {
+		if _, ok := pending[string(key)]; ok {
+			return nil
+		}
+		return add(key, val)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range pending {
+		if val != nil {
+			if err := add([]byte(key), val); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.height != b.height {
+			return a.height > b.height
+		}
+		if a.txIndex != b.txIndex {
+			return a.txIndex < b.txIndex
+		}
+		return a.Vout < b.Vout
+	})
+	var unspent []UTXO
+	for _, entry := range entries {
+		unspent = append(unspent, entry.UTXO)
+	}
+	return unspent, nil
+}
+
+// chainHashes returns the hashes of the blocks of db from genesis to the tip.
+func chainHashes(db storage.Reader) ([][]byte, error) {
+	var hashes [][]byte
+	hash, err := db.Get([]byte(dbLastHashKey))
+	if err != nil {
+		return nil, err
+	}
+	for len(hash) != 0 {
+		header, err := getHeader(db, hash)
+		if err != nil {
+			return nil, readError(hash, err)
+		}
+		hashes = append(hashes, hash)
+		hash = header.PrevBlockHash
+	}
+	slices.Reverse(hashes)
+	return hashes, nil
+}
+
+// checkBodies fails with ErrPruned if the body of any of the blocks is gone.
+func checkBodies(db storage.Reader, hashes [][]byte) error {
+	for _, hash := range hashes {
+		_, err := db.Get(bodyKey(hash))
+		if errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("%w: transactions of block %x", ErrPruned, hash)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// connectUTXOsFrom connects hashes[from:] to the UTXO set, hashes being the
+// chain from genesis, moving dbUTXOTipKey along block by block.
+func connectUTXOsFrom(db storage.Store, hashes [][]byte, from int) error {
+	for height := from; height < len(hashes); height++ {
+		hash := hashes[height]
+		err := db.Batch(func(b storage.Batch) error {
+			block, err := getBlock(b, hash)
+			if err != nil {
+				return readError(hash, err)
+			}
+			err = connectUTXOs(b, block, height)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(dbUTXOTipKey), hash)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// catchUpUTXOSet brings the UTXO set of db, which matches block utxoTip, up
+// to the tip by connecting the blocks after utxoTip. Connecting a block is
+// idempotent, so it doesn't matter if some of their changes were already
+// written. The set is rebuilt if utxoTip is not on the chain.
+func catchUpUTXOSet(db storage.Store, utxoTip []byte) error {
+	hashes, err := chainHashes(db)
+	if err != nil {
+		return err
+	}
+	for i, hash := range hashes {
+		if bytes.Equal(hash, utxoTip) {
+			err := checkBodies(db, hashes[i+1:])
+			if err != nil {
+				return err
+			}
+			return connectUTXOsFrom(db, hashes, i+1)
+		}
+	}
+	return rebuildUTXOSet(db)
+}
+
+// rebuildUTXOSet replaces the UTXO set of db with one computed from every
+// block from genesis to the tip. It needs every block body, and leaves the
+// set alone if any was pruned.
+func rebuildUTXOSet(db storage.Store) error {
+	hashes, err := chainHashes(db)
+	if err != nil {
+		return err
+	}
+	err = checkBodies(db, hashes)
+	if err != nil {
+		return err
+	}
+
+	// Forget which block the set matched first, so a rebuild cut short is
+	// noticed and redone when the chain is next opened.
+	err = db.Delete([]byte(dbUTXOTipKey))
+	if err != nil {
+		return err
+	}
+	var stale [][]byte
+	err = db.Iterate([]byte{utxoKeyPrefix}, func(key, _ []byte) error {
+		stale = append(stale, append([]byte(nil), key...))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = deleteKeys(db, stale)
+	if err != nil {
+		return err
+	}
+	return connectUTXOsFrom(db, hashes, 0)
+}
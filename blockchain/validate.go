@@ -0,0 +1,154 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// medianTimeBlocks is how many blocks the median time past is taken over.
+	medianTimeBlocks = 11
+	// maxFutureBlockTime is how far ahead of the local clock a block's
+	// timestamp may be.
+	maxFutureBlockTime = 2 * time.Hour
+)
+
+// medianTimePast returns the median timestamp of the last medianTimeBlocks
+// blocks ending at hash, or 0 if hash is empty.
+func (bc *Blockchain) medianTimePast(hash []byte) (int64, error) {
+	var timestamps []int64
+	for len(hash) != 0 && len(timestamps) < medianTimeBlocks {
+		header, err := bc.getHeader(hash)
+		if err != nil {
+			return 0, readError(hash, err)
+		}
+		timestamps = append(timestamps, header.Timestamp)
+		hash = header.PrevBlockHash
+	}
+	return medianTime(timestamps), nil
+}
+
+// medianTime sorts timestamps and returns the middle one, or 0 if there are
+// none.
+func medianTime(timestamps []int64) int64 {
+	if len(timestamps) == 0 {
+		return 0
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// checkBlockTime rejects timestamps that are not after the median time past
+// of the parent, or that are too far ahead of the local clock. Without the
+// first rule a miner could backdate blocks to drag the difficulty down.
+func (bc *Blockchain) checkBlockTime(header *BlockHeader) error {
+	if len(header.PrevBlockHash) != 0 {
+		mtp, err := bc.medianTimePast(header.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		if header.Timestamp <= mtp {
+			return fmt.Errorf("timestamp %d is not after median time past %d", header.Timestamp, mtp)
+		}
+	}
+	maxTime := bc.now().Add(maxFutureBlockTime).Unix()
+	if header.Timestamp > maxTime {
+		return fmt.Errorf("timestamp %d is more than %s in the future", header.Timestamp, maxFutureBlockTime)
+	}
+	return nil
+}
+
+// errStaleTip is returned by validateBlock when block does not build on the
+// current tip, for example because another block was connected while it was
+// being mined.
+var errStaleTip = errors.New("block does not extend the tip")
+
+// validateBlock checks that block is well formed and may extend the tip. The
+// caller must hold writeMu.
+func (bc *Blockchain) validateBlock(block *Block) error {
+	tip := bc.Tip()
+	if !bytes.Equal(block.PrevBlockHash, tip) {
+		return fmt.Errorf("%w: previous block %x is not the tip %x", errStaleTip, block.PrevBlockHash, tip)
+	}
+	if !bytes.Equal(block.Hash, block.BlockHeader.Hash()) {
+		return errors.New("hash does not match header")
+	}
+	if !NewProofOfWork(&block.BlockHeader).Validate() {
+		return errors.New("hash does not meet target")
+	}
+	bits, err := bc.nextBits(tip)
+	if err != nil {
+		return err
+	}
+	if block.Bits != bits {
+		return fmt.Errorf("bits %08x, expected %08x", block.Bits, bits)
+	}
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return errors.New("merkle root does not match transactions")
+	}
+	err = bc.checkBlockTime(&block.BlockHeader)
+	if err != nil {
+		return err
+	}
+	err = checkCoinbase(block)
+	if err != nil {
+		return err
+	}
+	// Migrated blocks skip signature checks, so they are only accepted when
+	// reindexing, among the blocks MigrateGobDB wrote.
+	legacy := block.Version == legacyBlockVersion
+	if legacy {
+		height, err := bc.getBlockHeight(block.PrevBlockHash)
+		if err != nil {
+			return err
+		}
+		if height >= bc.legacyBlocks {
+			return errors.New("migrated blocks are only accepted when reindexing the chain they were migrated into")
+		}
+	}
+	// Every transaction is verified against the UTXO set at the tip, so
+	// outputs spent by more than one of them are caught separately.
+	spent := make(map[string][]byte)
+	for _, tx := range block.Transactions {
+		err := addSpends(spent, tx)
+		if err != nil {
+			return err
+		}
+		err = bc.checkNewID(tx)
+		if err != nil {
+			return err
+		}
+		err = bc.verifyTransaction(tx, !legacy)
+		if err != nil {
+			return fmt.Errorf("transaction %x: %w", tx.ID, err)
+		}
+	}
+	return nil
+}
+
+// checkCoinbase requires block to start with its only coinbase, paying out no
+// more than the block reward.
+func checkCoinbase(block *Block) error {
+	if len(block.Transactions) == 0 || !block.Transactions[0].IsCoinbase() {
+		return errors.New("first transaction is not a coinbase")
+	}
+	for _, tx := range block.Transactions[1:] {
+		if tx.IsCoinbase() {
+			return fmt.Errorf("transaction %x: more than one coinbase", tx.ID)
+		}
+	}
+	value := 0
+	for _, out := range block.Transactions[0].Vout {
+		if out.Value <= 0 {
+			return errors.New("coinbase output value must be positive")
+		}
+		if out.Value > blockReward-value {
+			return fmt.Errorf("coinbase pays more than the block reward of %d", blockReward)
+		}
+		value += out.Value
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package blockchain_test
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/testutil"
+)
+
+// mineOnTip mines transactions into a block on the tip without adding a
+// coinbase, so blocks breaking the coinbase rules can be built.
+func mineOnTip(t *testing.T, h *testutil.Harness, transactions ...*blockchain.Transaction) *blockchain.Block {
+	t.Helper()
+	bits, err := h.Chain.NextBits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Clock.Advance(time.Minute)
+	return blockchain.NewBlock(transactions, h.Chain.Tip(), bits, h.Clock.Now().Unix())
+}
+
+func coinbase(t *testing.T, to string) *blockchain.Transaction {
+	t.Helper()
+	tx, err := blockchain.NewCoinbaseTX(to, "", blockchain.RegTestParams.Bech32HRP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestCoinbaseRules(t *testing.T) {
+	h := testutil.NewHarness(t)
+	address := h.NewAddress()
+
+	overpaying := coinbase(t, address)
+	overpaying.Vout[0].Value++
+	overpaying.SetID()
+	tests := []struct {
+		name         string
+		transactions []*blockchain.Transaction
+		want         string
+	}{
+		{"None", nil, "first transaction is not a coinbase"},
+		{"Two", []*blockchain.Transaction{coinbase(t, address), coinbase(t, address)}, "more than one coinbase"},
+		{"Overpaying", []*blockchain.Transaction{overpaying}, "more than the block reward"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := h.Chain.AddBlock(mineOnTip(t, h, test.transactions...))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("AddBlock: got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+
+	if err := h.Chain.AddBlock(mineOnTip(t, h, coinbase(t, address))); err != nil {
+		t.Fatalf("AddBlock: %v", err)
+	}
+	if got := h.Balance(address); got != 100 {
+		t.Errorf("balance = %d, want 100", got)
+	}
+}
+
+func TestMineBlockAddsEmptyCoinbase(t *testing.T) {
+	h := testutil.NewHarness(t)
+	to := h.NewAddress()
+	h.Send(h.Miner, to, 30)
+
+	block := h.Chain.Iterator().Next()
+	if len(block.Transactions) != 2 || !block.Transactions[0].IsCoinbase() {
+		t.Fatalf("block does not start with a coinbase")
+	}
+	if n := len(block.Transactions[0].Vout); n != 0 {
+		t.Errorf("coinbase has %d outputs, want none", n)
+	}
+	if got := h.Balance(h.Miner) + h.Balance(to); got != 100 {
+		t.Errorf("total balance = %d, want 100", got)
+	}
+}
+
+func TestDuplicateTransactionID(t *testing.T) {
+	h := testutil.NewHarness(t)
+	address := h.NewAddress()
+
+	first, err := blockchain.NewCoinbaseTX(address, "same data", blockchain.RegTestParams.Bech32HRP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Chain.AddBlock(mineOnTip(t, h, first)); err != nil {
+		t.Fatalf("AddBlock: %v", err)
+	}
+	again, err := blockchain.NewCoinbaseTX(address, "same data", blockchain.RegTestParams.Bech32HRP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Chain.AddBlock(mineOnTip(t, h, again))
+	if !errors.Is(err, blockchain.ErrDuplicateTransaction) {
+		t.Fatalf("AddBlock: got %v, want ErrDuplicateTransaction", err)
+	}
+
+	h.Generate(2, address)
+	if got := h.Balance(address); got != 300 {
+		t.Errorf("balance = %d, want 300", got)
+	}
+}
+
+// medianTimePast returns the median timestamp of the last eleven blocks.
+func medianTimePast(t *testing.T, h *testutil.Harness) int64 {
+	t.Helper()
+	var timestamps []int64
+	it := h.Chain.Iterator()
+	for range 11 {
+		timestamps = append(timestamps, it.Next().Timestamp)
+	}
+	slices.Sort(timestamps)
+	return timestamps[len(timestamps)/2]
+}
+
+func TestBlockTimeBoundaries(t *testing.T) {
+	h := testutil.NewHarness(t)
+	address := h.NewAddress()
+	for range 11 {
+		h.Clock.Advance(time.Minute)
+		h.Generate(1, address)
+	}
+	h.Clock.Advance(time.Hour)
+	now := h.Clock.Now().Unix()
+	maxTime := now + int64(2*time.Hour/time.Second)
+
+	tests := []struct {
+		name      string
+		timestamp func() int64
+		want      string
+	}{
+		{"MedianTimePast", func() int64 { return medianTimePast(t, h) }, "not after median time past"},
+		{"AfterMedianTimePast", func() int64 { return medianTimePast(t, h) + 1 }, ""},
+		{"TwoHoursAhead", func() int64 { return maxTime }, ""},
+		{"MoreThanTwoHoursAhead", func() int64 { return maxTime + 1 }, "in the future"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bits, err := h.Chain.NextBits()
+			if err != nil {
+				t.Fatal(err)
+			}
+			block := blockchain.NewBlock([]*blockchain.Transaction{coinbase(t, address)}, h.Chain.Tip(), bits, test.timestamp())
+			err = h.Chain.AddBlock(block)
+			if test.want == "" {
+				if err != nil {
+					t.Fatalf("AddBlock: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("AddBlock: got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestMinerTimestamp(t *testing.T) {
+	h := testutil.NewHarness(t)
+	address := h.NewAddress()
+	for range 11 {
+		h.Clock.Advance(time.Minute)
+		h.Generate(1, address)
+	}
+
+	// With the clock behind the median time past, blocks are stamped just
+	// past it.
+	h.Clock.Advance(-time.Hour)
+	mtp := medianTimePast(t, h)
+	if got := h.Generate(1, address)[0].Timestamp; got != mtp+1 {
+		t.Errorf("timestamp with the clock behind = %d, want median time past + 1 = %d", got, mtp+1)
+	}
+
+	h.Clock.Advance(2 * time.Hour)
+	if got, want := h.Generate(1, address)[0].Timestamp, h.Clock.Now().Unix(); got != want {
+		t.Errorf("timestamp with the clock ahead = %d, want the current time %d", got, want)
+	}
+}
+
+// spend signs a payment of amount from the wallet address from to to,
+// spending exactly inputs.
+func spend(t *testing.T, h *testutil.Harness, from, to string, amount int, inputs ...blockchain.Outpoint) *blockchain.Transaction {
+	t.Helper()
+	tx, err := blockchain.NewUTXOTransaction(h.Wallets, from, to, amount, h.Chain, blockchain.SendOptions{Inputs: inputs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+// fundedOutpoint mines a block paying address and returns its reward output.
+func fundedOutpoint(t *testing.T, h *testutil.Harness, address string) blockchain.Outpoint {
+	t.Helper()
+	block := h.Generate(1, address)[0]
+	return blockchain.Outpoint{Txid: block.Transactions[0].ID, Vout: 0}
+}
+
+func wantSpendError(t *testing.T, err, target error, outpoint blockchain.Outpoint) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Fatalf("got %v, want %v", err, target)
+	}
+	if !strings.Contains(err.Error(), outpoint.String()) {
+		t.Errorf("error %q does not name the outpoint %s", err, outpoint)
+	}
+}
+
+func TestDoubleSpendWithinTransaction(t *testing.T) {
+	h := testutil.NewHarness(t)
+	from, to := h.NewAddress(), h.NewAddress()
+	outpoint := fundedOutpoint(t, h, from)
+
+	tx := spend(t, h, from, to, 100, outpoint)
+	tx.Vin = append(tx.Vin, tx.Vin[0])
+	tx.Vout[0].Value = 200
+	tx.SetID()
+	if err := h.Chain.SignTransaction(tx, h.Wallets); err != nil {
+		t.Fatal(err)
+	}
+
+	wantSpendError(t, h.Chain.AcceptTransaction(tx), blockchain.ErrDoubleSpend, outpoint)
+	wantSpendError(t, h.Chain.AddBlock(mineOnTip(t, h, coinbase(t, from), tx)), blockchain.ErrDoubleSpend, outpoint)
+	if got := h.Balance(to); got != 0 {
+		t.Errorf("balance of the recipient = %d, want 0", got)
+	}
+}
+
+func TestDoubleSpendWithinBlock(t *testing.T) {
+	h := testutil.NewHarness(t)
+	from, to := h.NewAddress(), h.NewAddress()
+	outpoint := fundedOutpoint(t, h, from)
+
+	first := spend(t, h, from, to, 30, outpoint)
+	second := spend(t, h, from, to, 40, outpoint)
+	err := h.Chain.AddBlock(mineOnTip(t, h, coinbase(t, from), first, second))
+	wantSpendError(t, err, blockchain.ErrDoubleSpend, outpoint)
+	if got := h.Balance(to); got != 0 {
+		t.Errorf("balance of the recipient = %d, want 0", got)
+	}
+}
+
+func TestDoubleSpendAgainstMempool(t *testing.T) {
+	h := testutil.NewHarness(t)
+	from, to := h.NewAddress(), h.NewAddress()
+	outpoint := fundedOutpoint(t, h, from)
+
+	first := spend(t, h, from, to, 30, outpoint)
+	second := spend(t, h, from, to, 40, outpoint)
+	if err := h.Chain.AcceptTransaction(first); err != nil {
+		t.Fatal(err)
+	}
+	wantSpendError(t, h.Chain.AcceptTransaction(second), blockchain.ErrDoubleSpend, outpoint)
+	if n := len(h.Chain.MempoolTransactions()); n != 1 {
+		t.Errorf("mempool holds %d transactions, want 1", n)
+	}
+
+	// Once the first is mined, the output is gone from the UTXO set.
+	if _, err := h.Chain.MineBlock(h.Chain.MempoolTransactions()); err != nil {
+		t.Fatal(err)
+	}
+	wantSpendError(t, h.Chain.AcceptTransaction(second), blockchain.ErrMissingOutput, outpoint)
+	wantSpendError(t, h.Chain.AddBlock(mineOnTip(t, h, coinbase(t, from), second)), blockchain.ErrMissingOutput, outpoint)
+	if got := h.Balance(to); got != 30 {
+		t.Errorf("balance of the recipient = %d, want 30", got)
+	}
+}
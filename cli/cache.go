@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+)
+
+// closeChain closes bc, first printing its cache statistics if -cachestats
+// was given.
+func (cli *CLI) closeChain(bc *blockchain.Blockchain) {
+	if cli.cacheStats {
+		printCacheStats(bc.CacheStats())
+	}
+	bc.CloseDB()
+}
+
+func printCacheStats(m blockchain.CacheMetrics) {
+	fmt.Printf("%-8s %10s %10s %9s %17s\n", "Cache", "Hits", "Misses", "Hit rate", "Entries/Capacity")
+	for _, c := range []struct {
+		name  string
+		stats blockchain.CacheStats
+	}{
+		{"headers", m.Headers},
+		{"heights", m.Heights},
+		{"blocks", m.Blocks},
+		{"utxos", m.UTXOs},
+	} {
+		fmt.Printf("%-8s %10d %10d %8.1f%% %17s\n", c.name, c.stats.Hits, c.stats.Misses,
+			100*c.stats.HitRate(), fmt.Sprintf("%d/%d", c.stats.Entries, c.stats.Capacity))
+	}
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+)
+
+func (cli *CLI) exportChain(path string) {
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	f, err := os.Create(path)
+	if err != nil {
+		fail(err)
+	}
+	blocks := 0
+	err = bc.Export(f, func(height int) {
+		blocks = height
+		fmt.Printf("\rExported %d blocks", height)
+	})
+	if err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	fmt.Println()
+	if err != nil {
+		_ = os.Remove(path)
+		cli.closeChain(bc)
+		fail(err)
+	}
+	fmt.Printf("Wrote %d blocks to %s.\n", blocks, path)
+}
+
+func (cli *CLI) importChain(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		fail(err)
+	}
+	defer f.Close()
+
+	blocks := 0
+	bc, err := blockchain.ImportBlockchain(f, cli.chainConfig(), func(height int) {
+		blocks = height
+		fmt.Printf("\rProcessed %d blocks", height)
+	})
+	fmt.Println()
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+	fmt.Printf("Processed %d blocks from %s; the tip is %x.\n", blocks, path, bc.Tip())
+}
@@ -1,41 +1,111 @@
 package cli
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/storage"
 	"github.com/Triad-0112/BlockChain.git/wallet"
 )
 
-type CLI struct{}
+type CLI struct {
+	params     *blockchain.Params
+	prune      int
+	backend    string
+	cache      blockchain.CacheSizes
+	cacheStats bool
+}
 
 func NewCLI() *CLI {
-	return &CLI{}
+	return &CLI{params: &blockchain.MainNetParams}
+}
+
+func (cli *CLI) chainConfig() blockchain.Config {
+	return blockchain.Config{Params: cli.params, Prune: cli.prune, Backend: cli.backend, Cache: cli.cache}
 }
 
 func (cli *CLI) printUsage() {
-	fmt.Println("Usage:")
+	fmt.Println("Usage: [-regtest] [-prune N] [-backend badger|bbolt] [-blockcache N] [-utxocache N] [-cachestats] COMMAND [OPTIONS]")
+	fmt.Println("  -regtest          - Use the regression test network (minimal difficulty, separate database)")
+	fmt.Println("  -prune N          - Delete the transactions of all but the last N blocks; balances and sending keep working from the UTXO set")
+	fmt.Println("  -backend NAME     - Store a new blockchain with badger (default) or bbolt; existing ones are opened with the backend they were created with")
+	fmt.Println("  -blockcache N     - Number of decoded blocks to cache; negative disables the cache")
+	fmt.Println("  -utxocache N      - Number of unspent outputs to cache, and of UTXO changes to hold before writing them out; negative disables the cache")
+	fmt.Println("  -cachestats       - Print cache hit rates when the command finishes")
 	fmt.Println("  createblockchain -address ADDRESS - Create a blockchain and send genesis block reward to ADDRESS")
-	fmt.Println("  createwallet      - Generates a new key-pair and saves it into the wallet file")
+	fmt.Println("  createwallet [-type base58|bech32] [-account ACCOUNT] [-label LABEL] - Generates a new key-pair and saves it into the wallet file")
 	fmt.Println("  listaddresses     - Lists all addresses from the wallet file")
 	fmt.Println("  printchain        - Print all the blocks of the blockchain")
-	fmt.Println("  send -from FROM -to TO -amount AMOUNT - Send AMOUNT of coins from FROM address to TO")
-	fmt.Println("  getbalance -address ADDRESS - Get balance of ADDRESS")
+	fmt.Println("  send -from FROM|-account ACCOUNT -to TO -amount AMOUNT [-strategy largest|smallest|bnb|random] [-inputs TXID:VOUT,...] - Send AMOUNT of coins from FROM address, or from any address in ACCOUNT, to TO")
+	fmt.Println("  getbalance [-address ADDRESS|-account ACCOUNT] - Get balance of ADDRESS, of every address in ACCOUNT, or of every wallet address including watch-only ones")
 	fmt.Println("  mine -address ADDRESS - Mine a new block and get a reward sent to ADDRESS")
+	fmt.Println("  generate -n N -address ADDRESS - Mine N blocks in a row, sending every reward to ADDRESS")
+	fmt.Println("  migratedb         - Upgrade a blockchain database written by an older version (gob encoding, or no UTXO set) to the current format")
+	fmt.Println("  createrawtransaction -inputs JSON -outputs JSON - Build an unsigned transaction spending the given outpoints")
+	fmt.Println("  signrawtransaction -hex HEX [-prevouts JSON] - Sign a raw transaction with keys from the wallet file; -prevouts supplies spent outputs when the chain is not available")
+	fmt.Println("  decoderawtransaction -hex HEX - Print a raw transaction as JSON")
+	fmt.Println("  sendrawtransaction -hex HEX - Verify a signed raw transaction and mine it into a block")
+	fmt.Println("  importaddress -address ADDRESS - Watch ADDRESS without holding its private key")
+	fmt.Println("  importpubkey -pubkey HEX - Watch the address of a hex-encoded public key without holding its private key")
+	fmt.Println("  listtransactions [-address ADDRESS] - List transactions paying to or spending from ADDRESS, or from every wallet address")
+	fmt.Println("  dumpprivkey -address ADDRESS - Print the private key of ADDRESS in wallet import format")
+	fmt.Println("  importprivkey -key WIF - Add a private key in wallet import format to the wallet file and rescan the chain for it")
+	fmt.Println("  listunspent [-address ADDRESS] - List unspent outputs of ADDRESS, or of every wallet address")
+	fmt.Println("  sendmany -from FROM|-account ACCOUNT -to JSON [-strategy STRATEGY] - Pay several addresses in one transaction, e.g. -to '{\"ADDRESS\":10,\"ADDRESS2\":20}'")
+	fmt.Println("  setlabel -address ADDRESS -label LABEL - Attach a label to a wallet address")
+	fmt.Println("  setaccount -address ADDRESS -account ACCOUNT - Move a wallet address and its change into ACCOUNT")
+	fmt.Println("  listaccounts      - List wallet accounts with their number of addresses and balances")
+	fmt.Println("  serve [-listen HOST:PORT] - Serve WebSocket notifications of new blocks, addresses and txids on /ws")
+	fmt.Println("  exportchain -out FILE - Write every block from genesis to the tip to FILE in a portable format")
+	fmt.Println("  importchain -in FILE - Validate and connect the blocks in FILE, creating the blockchain if there is none; blocks already present are skipped")
+	fmt.Println("  gettransaction -txid TXID - Print a transaction from the chain")
+	fmt.Println("  reindex           - Re-validate every stored block from genesis and rebuild the chainwork and UTXO set from them; an interrupted reindex resumes where it stopped")
 }
 
-func (cli *CLI) validateArgs() {
-	if len(os.Args) < 2 {
+func (cli *CLI) validateArgs(args []string) {
+	if len(args) < 1 {
 		cli.printUsage()
 		os.Exit(1)
 	}
 }
 
 func (cli *CLI) Run() {
-	cli.validateArgs()
+	globalFlags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	regtest := globalFlags.Bool("regtest", false, "Use the regression test network")
+	prune := globalFlags.Int("prune", 0, "Keep the transactions of only the last N blocks")
+	backend := globalFlags.String("backend", "", "Storage backend of a new blockchain: badger or bbolt")
+	blockCache := globalFlags.Int("blockcache", 0, "Number of decoded blocks to cache (default 64)")
+	utxoCache := globalFlags.Int("utxocache", 0, "Number of unspent outputs to cache (default 20000)")
+	cacheStats := globalFlags.Bool("cachestats", false, "Print cache hit rates when the command finishes")
+	err := globalFlags.Parse(os.Args[1:])
+	if err != nil {
+		fail(err)
+	}
+	if *regtest {
+		cli.params = &blockchain.RegTestParams
+	}
+	if *prune < 0 {
+		fail(fmt.Errorf("-prune must be positive, got %d", *prune))
+	}
+	cli.prune = *prune
+	cli.cache = blockchain.CacheSizes{Blocks: *blockCache, UTXOs: *utxoCache}
+	cli.cacheStats = *cacheStats
+	switch *backend {
+	case "", storage.Badger, storage.Bolt:
+		cli.backend = *backend
+	default:
+		fail(fmt.Errorf("-backend must be %s or %s, got %q", storage.Badger, storage.Bolt, *backend))
+	}
+	args := globalFlags.Args()
+	cli.validateArgs(args)
 
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
@@ -44,47 +114,206 @@ func (cli *CLI) Run() {
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	generateCmd := flag.NewFlagSet("generate", flag.ExitOnError)
+	migrateDBCmd := flag.NewFlagSet("migratedb", flag.ExitOnError)
+	createRawTxCmd := flag.NewFlagSet("createrawtransaction", flag.ExitOnError)
+	signRawTxCmd := flag.NewFlagSet("signrawtransaction", flag.ExitOnError)
+	decodeRawTxCmd := flag.NewFlagSet("decoderawtransaction", flag.ExitOnError)
+	sendRawTxCmd := flag.NewFlagSet("sendrawtransaction", flag.ExitOnError)
+	importAddressCmd := flag.NewFlagSet("importaddress", flag.ExitOnError)
+	importPubKeyCmd := flag.NewFlagSet("importpubkey", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
+	dumpPrivKeyCmd := flag.NewFlagSet("dumpprivkey", flag.ExitOnError)
+	importPrivKeyCmd := flag.NewFlagSet("importprivkey", flag.ExitOnError)
+	listUnspentCmd := flag.NewFlagSet("listunspent", flag.ExitOnError)
+	sendManyCmd := flag.NewFlagSet("sendmany", flag.ExitOnError)
+	setLabelCmd := flag.NewFlagSet("setlabel", flag.ExitOnError)
+	setAccountCmd := flag.NewFlagSet("setaccount", flag.ExitOnError)
+	listAccountsCmd := flag.NewFlagSet("listaccounts", flag.ExitOnError)
+	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
+	exportChainCmd := flag.NewFlagSet("exportchain", flag.ExitOnError)
+	importChainCmd := flag.NewFlagSet("importchain", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	reindexCmd := flag.NewFlagSet("reindex", flag.ExitOnError)
 
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "The address to send genesis block reward to")
+	createWalletType := createWalletCmd.String("type", "base58", "Address format: base58 or bech32")
+	createWalletAccount := createWalletCmd.String("account", "", "Account to put the new address in")
+	createWalletLabel := createWalletCmd.String("label", "", "Label for the new address")
 	sendFrom := sendCmd.String("from", "", "Source wallet address")
+	sendAccount := sendCmd.String("account", "", "Source wallet account, instead of -from")
 	sendTo := sendCmd.String("to", "", "Destination wallet address")
 	sendAmount := sendCmd.Int("amount", 0, "Amount to send")
+	sendStrategy := sendCmd.String("strategy", "bnb", "Coin selection strategy: largest, smallest, bnb or random")
+	sendInputs := sendCmd.String("inputs", "", "Comma-separated TXID:VOUT outputs to spend instead of selecting automatically")
 	getBalanceAddress := getBalanceCmd.String("address", "", "The address to get balance for")
+	getBalanceAccount := getBalanceCmd.String("account", "", "The account to get balance for")
 	mineAddress := mineCmd.String("address", "", "The miner's address to receive the reward")
+	generateCount := generateCmd.Int("n", 1, "Number of blocks to mine")
+	generateAddress := generateCmd.String("address", "", "The miner's address to receive the rewards")
+	createRawTxInputs := createRawTxCmd.String("inputs", "", "JSON array of {\"txid\",\"vout\"} outpoints to spend")
+	createRawTxOutputs := createRawTxCmd.String("outputs", "", "JSON array of {\"address\",\"amount\"} outputs to create")
+	signRawTxHex := signRawTxCmd.String("hex", "", "Hex-encoded transaction to sign")
+	signRawTxPrevOuts := signRawTxCmd.String("prevouts", "", "JSON array of {\"txid\",\"vout\",\"address\",\"amount\"} outputs being spent")
+	decodeRawTxHex := decodeRawTxCmd.String("hex", "", "Hex-encoded transaction to decode")
+	sendRawTxHex := sendRawTxCmd.String("hex", "", "Hex-encoded signed transaction to send")
+	importAddressAddress := importAddressCmd.String("address", "", "The address to watch")
+	importPubKeyHex := importPubKeyCmd.String("pubkey", "", "Hex-encoded public key to watch")
+	listTransactionsAddress := listTransactionsCmd.String("address", "", "The address to list transactions for")
+	dumpPrivKeyAddress := dumpPrivKeyCmd.String("address", "", "The wallet address to export the key of")
+	importPrivKeyWIF := importPrivKeyCmd.String("key", "", "Private key in wallet import format")
+	listUnspentAddress := listUnspentCmd.String("address", "", "The address to list unspent outputs for")
+	sendManyFrom := sendManyCmd.String("from", "", "Source wallet address")
+	sendManyAccount := sendManyCmd.String("account", "", "Source wallet account, instead of -from")
+	sendManyTo := sendManyCmd.String("to", "", "JSON object mapping destination addresses to amounts")
+	sendManyStrategy := sendManyCmd.String("strategy", "bnb", "Coin selection strategy: largest, smallest, bnb or random")
+	setLabelAddress := setLabelCmd.String("address", "", "The wallet address to label")
+	setLabelLabel := setLabelCmd.String("label", "", "The label, or empty to clear it")
+	setAccountAddress := setAccountCmd.String("address", "", "The wallet address to move")
+	setAccountAccount := setAccountCmd.String("account", "", "The account name, or empty for the default account")
+	serveListen := serveCmd.String("listen", "localhost:8332", "Address to listen on")
+	exportChainOut := exportChainCmd.String("out", "", "File to write the blocks to")
+	importChainIn := importChainCmd.String("in", "", "File written by exportchain")
+	getTransactionTxid := getTransactionCmd.String("txid", "", "ID of the transaction to print")
 
-	switch os.Args[1] {
+	switch args[0] {
 	case "createblockchain":
-		err := createBlockchainCmd.Parse(os.Args[2:])
+		err := createBlockchainCmd.Parse(args[1:])
 		if err != nil {
-			log.Panic(err)
+			fail(err)
 		}
 	case "createwallet":
-		err := createWalletCmd.Parse(os.Args[2:])
+		err := createWalletCmd.Parse(args[1:])
 		if err != nil {
-			log.Panic(err)
+			fail(err)
 		}
 	case "listaddresses":
-		err := listAddressesCmd.Parse(os.Args[2:])
+		err := listAddressesCmd.Parse(args[1:])
 		if err != nil {
-			log.Panic(err)
+			fail(err)
 		}
 	case "printchain":
-		err := printChainCmd.Parse(os.Args[2:])
+		err := printChainCmd.Parse(args[1:])
 		if err != nil {
-			log.Panic(err)
+			fail(err)
 		}
 	case "send":
-		err := sendCmd.Parse(os.Args[2:])
+		err := sendCmd.Parse(args[1:])
 		if err != nil {
-			log.Panic(err)
+			fail(err)
 		}
 	case "getbalance":
-		err := getBalanceCmd.Parse(os.Args[2:])
+		err := getBalanceCmd.Parse(args[1:])
 		if err != nil {
-			log.Panic(err)
+			fail(err)
 		}
 	case "mine":
-		_ = mineCmd.Parse(os.Args[2:])
+		_ = mineCmd.Parse(args[1:])
+	case "generate":
+		err := generateCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "migratedb":
+		err := migrateDBCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "createrawtransaction":
+		err := createRawTxCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "signrawtransaction":
+		err := signRawTxCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "decoderawtransaction":
+		err := decodeRawTxCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "sendrawtransaction":
+		err := sendRawTxCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "importaddress":
+		err := importAddressCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "importpubkey":
+		err := importPubKeyCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "listtransactions":
+		err := listTransactionsCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "dumpprivkey":
+		err := dumpPrivKeyCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "importprivkey":
+		err := importPrivKeyCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "listunspent":
+		err := listUnspentCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "sendmany":
+		err := sendManyCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "setlabel":
+		err := setLabelCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "setaccount":
+		err := setAccountCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "listaccounts":
+		err := listAccountsCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "serve":
+		err := serveCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "exportchain":
+		err := exportChainCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "importchain":
+		err := importChainCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "gettransaction":
+		err := getTransactionCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
+	case "reindex":
+		err := reindexCmd.Parse(args[1:])
+		if err != nil {
+			fail(err)
+		}
 	default:
 		cli.printUsage()
 		os.Exit(1)
@@ -98,7 +327,7 @@ func (cli *CLI) Run() {
 		cli.createBlockchain(*createBlockchainAddress)
 	}
 	if createWalletCmd.Parsed() {
-		cli.createWallet()
+		cli.createWallet(*createWalletType, *createWalletAccount, *createWalletLabel)
 	}
 	if listAddressesCmd.Parsed() {
 		cli.listAddresses()
@@ -107,18 +336,24 @@ func (cli *CLI) Run() {
 		cli.printChain()
 	}
 	if sendCmd.Parsed() {
-		if *sendFrom == "" || *sendTo == "" || *sendAmount <= 0 {
+		if (*sendFrom != "") == isFlagSet(sendCmd, "account") || *sendTo == "" || *sendAmount <= 0 {
 			sendCmd.Usage()
 			os.Exit(1)
 		}
-		cli.send(*sendFrom, *sendTo, *sendAmount)
+		cli.send(*sendFrom, *sendAccount, *sendTo, *sendAmount, *sendStrategy, *sendInputs)
 	}
 	if getBalanceCmd.Parsed() {
-		if *getBalanceAddress == "" {
+		switch {
+		case *getBalanceAddress != "" && *getBalanceAccount != "":
 			getBalanceCmd.Usage()
 			os.Exit(1)
+		case *getBalanceAddress != "":
+			cli.getBalance(*getBalanceAddress)
+		case isFlagSet(getBalanceCmd, "account"):
+			cli.getAccountBalance(*getBalanceAccount)
+		default:
+			cli.getWalletBalance()
 		}
-		cli.getBalance(*getBalanceAddress)
 	}
 	if mineCmd.Parsed() {
 		if *mineAddress == "" {
@@ -127,120 +362,743 @@ func (cli *CLI) Run() {
 		}
 		cli.mine(*mineAddress)
 	}
+	if generateCmd.Parsed() {
+		if *generateAddress == "" || *generateCount <= 0 {
+			generateCmd.Usage()
+			os.Exit(1)
+		}
+		cli.generate(*generateCount, *generateAddress)
+	}
+	if migrateDBCmd.Parsed() {
+		cli.migrateDB()
+	}
+	if createRawTxCmd.Parsed() {
+		if *createRawTxInputs == "" || *createRawTxOutputs == "" {
+			createRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.createRawTransaction(*createRawTxInputs, *createRawTxOutputs)
+	}
+	if signRawTxCmd.Parsed() {
+		if *signRawTxHex == "" {
+			signRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.signRawTransaction(*signRawTxHex, *signRawTxPrevOuts)
+	}
+	if decodeRawTxCmd.Parsed() {
+		if *decodeRawTxHex == "" {
+			decodeRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.decodeRawTransaction(*decodeRawTxHex)
+	}
+	if sendRawTxCmd.Parsed() {
+		if *sendRawTxHex == "" {
+			sendRawTxCmd.Usage()
+			os.Exit(1)
+		}
+		cli.sendRawTransaction(*sendRawTxHex)
+	}
+	if importAddressCmd.Parsed() {
+		if *importAddressAddress == "" {
+			importAddressCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importAddress(*importAddressAddress)
+	}
+	if importPubKeyCmd.Parsed() {
+		if *importPubKeyHex == "" {
+			importPubKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importPubKey(*importPubKeyHex)
+	}
+	if listTransactionsCmd.Parsed() {
+		cli.listTransactions(*listTransactionsAddress)
+	}
+	if dumpPrivKeyCmd.Parsed() {
+		if *dumpPrivKeyAddress == "" {
+			dumpPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.dumpPrivKey(*dumpPrivKeyAddress)
+	}
+	if importPrivKeyCmd.Parsed() {
+		if *importPrivKeyWIF == "" {
+			importPrivKeyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importPrivKey(*importPrivKeyWIF)
+	}
+	if listUnspentCmd.Parsed() {
+		cli.listUnspent(*listUnspentAddress)
+	}
+	if sendManyCmd.Parsed() {
+		if (*sendManyFrom != "") == isFlagSet(sendManyCmd, "account") || *sendManyTo == "" {
+			sendManyCmd.Usage()
+			os.Exit(1)
+		}
+		cli.sendMany(*sendManyFrom, *sendManyAccount, *sendManyTo, *sendManyStrategy)
+	}
+	if setLabelCmd.Parsed() {
+		if *setLabelAddress == "" {
+			setLabelCmd.Usage()
+			os.Exit(1)
+		}
+		cli.setLabel(*setLabelAddress, *setLabelLabel)
+	}
+	if setAccountCmd.Parsed() {
+		if *setAccountAddress == "" {
+			setAccountCmd.Usage()
+			os.Exit(1)
+		}
+		cli.setAccount(*setAccountAddress, *setAccountAccount)
+	}
+	if listAccountsCmd.Parsed() {
+		cli.listAccounts()
+	}
+	if serveCmd.Parsed() {
+		cli.serve(*serveListen)
+	}
+	if exportChainCmd.Parsed() {
+		if *exportChainOut == "" {
+			exportChainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.exportChain(*exportChainOut)
+	}
+	if importChainCmd.Parsed() {
+		if *importChainIn == "" {
+			importChainCmd.Usage()
+			os.Exit(1)
+		}
+		cli.importChain(*importChainIn)
+	}
+	if getTransactionCmd.Parsed() {
+		if *getTransactionTxid == "" {
+			getTransactionCmd.Usage()
+			os.Exit(1)
+		}
+		cli.getTransaction(*getTransactionTxid)
+	}
+	if reindexCmd.Parsed() {
+		cli.reindex()
+	}
 }
 
 func (cli *CLI) createBlockchain(address string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+	if !wallet.ValidateAddress(address, cli.params.Bech32HRP) {
+		fail(invalidAddress(address))
 	}
-	if blockchain.DbExists() {
-		fmt.Println("Blockchain already exists.")
-		os.Exit(1)
+	bc, err := blockchain.CreateBlockchain(address, cli.chainConfig())
+	if err != nil {
+		fail(err)
 	}
-	bc := blockchain.NewBlockchain(address)
-	defer bc.CloseDB()
+	defer cli.closeChain(bc)
 	fmt.Println("Done! Blockchain created.")
 }
 
-func (cli *CLI) createWallet() {
-	wallets, _ := wallet.NewWallets()
-	address := wallets.CreateWallet()
-	wallets.SaveToFile()
+func (cli *CLI) createWallet(addressType, account, label string) {
+	wallets, err := wallet.NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		fail(err)
+	}
+	var address string
+	switch addressType {
+	case "base58":
+		address, err = wallets.CreateWallet()
+	case "bech32":
+		address, err = wallets.CreateBech32Wallet(cli.params.Bech32HRP)
+	default:
+		err = fmt.Errorf("unknown address type %q (want base58 or bech32)", addressType)
+	}
+	if err != nil {
+		fail(err)
+	}
+	wallets.Wallets[address].Account = account
+	wallets.Wallets[address].Label = label
+	err = wallets.SaveToFile()
+	if err != nil {
+		fail(err)
+	}
 	fmt.Printf("Your new address: %s\n", address)
 }
 
 func (cli *CLI) listAddresses() {
 	wallets, err := wallet.NewWallets()
 	if err != nil {
-		log.Panic(err)
+		fail(err)
 	}
 	addresses := wallets.GetAddresses()
 	for _, address := range addresses {
-		fmt.Println(address)
+		fmt.Println(address + addressNote(wallets.Wallets[address]))
+	}
+}
+
+// addressNote describes what kind of wallet entry w is, for address listings.
+func addressNote(w *wallet.Wallet) string {
+	var notes []string
+	if w.Label != "" {
+		notes = append(notes, fmt.Sprintf("%q", w.Label))
+	}
+	if w.Account != "" {
+		notes = append(notes, "account "+w.Account)
+	}
+	switch {
+	case w.WatchOnly:
+		notes = append(notes, "watch-only")
+	case w.Internal:
+		notes = append(notes, "change of "+w.Owner)
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(notes, ", ") + ")"
+}
+
+// accountName returns how account is shown to the user.
+func accountName(account string) string {
+	if account == "" {
+		return "default"
 	}
+	return account
+}
+
+// isFlagSet reports whether name was given on the command line, as opposed
+// to left at its default.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func (cli *CLI) setLabel(address, label string) {
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SetLabel(address, label)
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Labelled %s %q\n", address, label)
+}
+
+func (cli *CLI) setAccount(address, account string) {
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SetAccount(address, account)
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Moved %s to account %s\n", address, accountName(account))
+}
+
+// balanceOf sums the unspent outputs locked to address.
+func balanceOf(bc *blockchain.Blockchain, address string) int {
+	utxos, err := bc.FindUTXO(address)
+	if err != nil {
+		fail(err)
+	}
+	balance := 0
+	for _, out := range utxos {
+		balance += out.Value
+	}
+	return balance
+}
+
+// accountBalance sums the unspent outputs of every address in account.
+func accountBalance(bc *blockchain.Blockchain, wallets *wallet.Wallets, account string) int {
+	balance := 0
+	for _, address := range wallets.AccountAddresses(account) {
+		balance += balanceOf(bc, address)
+	}
+	return balance
+}
+
+func (cli *CLI) listAccounts() {
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
+	}
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	for _, account := range wallets.Accounts() {
+		addresses := wallets.AccountAddresses(account)
+		fmt.Printf("%s: %d addresses, balance %d\n", accountName(account), len(addresses), accountBalance(bc, wallets, account))
+	}
+}
+
+func (cli *CLI) getAccountBalance(account string) {
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
+	}
+	if len(wallets.AccountAddresses(account)) == 0 {
+		fail(fmt.Errorf("account %s has no addresses", accountName(account)))
+	}
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	fmt.Printf("Balance of account '%s': %d\n", accountName(account), accountBalance(bc, wallets, account))
+}
+
+func (cli *CLI) importAddress(address string) {
+	wallets, err := wallet.NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		fail(err)
+	}
+	err = wallets.ImportAddress(address, cli.params.Bech32HRP)
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Watching %s\n", address)
+}
+
+func (cli *CLI) importPubKey(pubKeyHex string) {
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		fail(err)
+	}
+	wallets, err := wallet.NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		fail(err)
+	}
+	address, err := wallets.ImportPubKey(pubKey)
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Watching %s\n", address)
+}
+
+func (cli *CLI) dumpPrivKey(address string) {
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
+	}
+	w, ok := wallets.Wallets[address]
+	if !ok {
+		fail(fmt.Errorf("address %s is not in the wallet", address))
+	}
+	wif, err := w.ExportWIF()
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(wif)
+}
+
+func (cli *CLI) importPrivKey(wif string) {
+	wallets, err := wallet.NewWallets()
+	if err != nil && !os.IsNotExist(err) {
+		fail(err)
+	}
+	address, err := wallets.ImportWIF(wif)
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Imported %s\n", address)
+
+	if !blockchain.ChainExists(cli.chainConfig()) {
+		return
+	}
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	fmt.Println("Rescanning the chain...")
+	history, err := bc.History(cli.pubKeyHashOf(address))
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Found %d transactions, balance of '%s': %d\n", len(history), address, balanceOf(bc, address))
 }
 
 func (cli *CLI) printChain() {
-	if !blockchain.DbExists() {
-		fmt.Println("No existing blockchain found. Create one first with 'createblockchain'.")
-		os.Exit(1)
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
 	}
-	bc := blockchain.OpenBlockchain()
-	defer bc.CloseDB()
+	defer cli.closeChain(bc)
 
-	bci := bc.Iterator()
+	hi := bc.HeaderIterator()
 	for {
-		block := bci.Next()
-		if block == nil {
+		header, hash := hi.Next()
+		if header == nil {
 			break
 		}
-		fmt.Printf("============ Block %x ============\n", block.Hash)
-		fmt.Printf("Prev. hash: %x\n", block.PrevBlockHash)
-		fmt.Printf("Difficulty: %d\n", block.Difficulty)
-		pow := blockchain.NewProofOfWork(block)
+		fmt.Printf("============ Block %x ============\n", hash)
+		fmt.Printf("Prev. hash: %x\n", header.PrevBlockHash)
+		fmt.Printf("Merkle root: %x\n", header.MerkleRoot)
+		fmt.Printf("Bits: %08x\n", header.Bits)
+		work, err := bc.ChainWork(hash)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("Chainwork: %x\n", work)
+		pow := blockchain.NewProofOfWork(header)
 		fmt.Printf("PoW: %t\n\n", pow.Validate())
+		block, err := bc.GetBlock(hash)
+		if errors.Is(err, blockchain.ErrPruned) {
+			fmt.Printf("Transactions pruned.\n\n")
+			continue
+		}
+		if err != nil {
+			fail(err)
+		}
 		for _, tx := range block.Transactions {
 			fmt.Println(tx)
 		}
 		fmt.Printf("\n")
-
-		if len(block.PrevBlockHash) == 0 {
-			break
-		}
+	}
+	if err := hi.Err(); err != nil {
+		fail(err)
 	}
 }
 
 func (cli *CLI) getBalance(address string) {
-	if !blockchain.DbExists() {
-		fmt.Println("No existing blockchain found. Create one first with 'createblockchain'.")
-		os.Exit(1)
+	if !wallet.ValidateAddress(address, cli.params.Bech32HRP) {
+		fail(invalidAddress(address))
 	}
-	if !wallet.ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
 	}
+	defer cli.closeChain(bc)
 
-	bc := blockchain.OpenBlockchain()
-	defer bc.CloseDB()
+	// Addresses in the wallet also own the change of their payments. The
+	// wallet is looked up by key hash so either address format finds it.
+	addresses := []string{address}
+	if wallets, err := wallet.NewWallets(); err == nil {
+		if w := wallets.FindByPubKeyHash(cli.pubKeyHashOf(address)); w != nil {
+			addresses = wallets.OwnedAddresses(string(w.GetAddress()))
+		}
+	}
 
 	balance := 0
-	UTXOs := bc.FindUTXO(address)
-
-	for _, out := range UTXOs {
-		balance += out.Value
+	for _, address := range addresses {
+		balance += balanceOf(bc, address)
 	}
 
 	fmt.Printf("Balance of '%s': %d\n", address, balance)
 }
 
-func (cli *CLI) send(from, to string, amount int) {
-	if !wallet.ValidateAddress(from) {
-		log.Panic("ERROR: Sender address is not valid")
+func (cli *CLI) getWalletBalance() {
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
 	}
-	if !wallet.ValidateAddress(to) {
-		log.Panic("ERROR: Recipient address is not valid")
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
 	}
+	defer cli.closeChain(bc)
 
-	bc := blockchain.OpenBlockchain()
-	defer bc.CloseDB()
+	total := 0
+	for _, address := range wallets.GetAddresses() {
+		w := wallets.Wallets[address]
+		balance := balanceOf(bc, address)
+		// A key listed under both address formats is counted once.
+		if wallets.FindByPubKeyHash(w.PubKeyHash()) == w {
+			total += balance
+		}
+		fmt.Printf("Balance of '%s'%s: %d\n", address, addressNote(wallets.Wallets[address]), balance)
+	}
+	fmt.Printf("Total: %d\n", total)
+}
 
-	tx, err := blockchain.NewUTXOTransaction(from, to, amount, bc)
+func (cli *CLI) listUnspent(address string) {
+	var addresses []string
+	if address != "" {
+		if !wallet.ValidateAddress(address, cli.params.Bech32HRP) {
+			fail(invalidAddress(address))
+		}
+		addresses = []string{address}
+	} else {
+		wallets, err := wallet.NewWallets()
+		if err != nil {
+			fail(err)
+		}
+		addresses = wallets.GetAddresses()
+	}
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
 	if err != nil {
-		log.Panic(err)
+		fail(err)
 	}
+	defer cli.closeChain(bc)
 
-	bc.MineBlock([]*blockchain.Transaction{tx})
+	for _, address := range addresses {
+		utxos, err := bc.FindUnspentOutputs(cli.pubKeyHashOf(address))
+		if err != nil {
+			fail(err)
+		}
+		for _, utxo := range utxos {
+			fmt.Printf("%s  %d  %s\n", utxo.Outpoint, utxo.Output.Value, address)
+		}
+	}
+}
+
+func (cli *CLI) listTransactions(address string) {
+	var addresses []string
+	if address != "" {
+		if !wallet.ValidateAddress(address, cli.params.Bech32HRP) {
+			fail(invalidAddress(address))
+		}
+		addresses = []string{address}
+	} else {
+		wallets, err := wallet.NewWallets()
+		if err != nil {
+			fail(err)
+		}
+		addresses = wallets.GetAddresses()
+	}
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	for _, address := range addresses {
+		fmt.Printf("============ %s ============\n", address)
+		history, err := bc.History(cli.pubKeyHashOf(address))
+		if err != nil {
+			fail(err)
+		}
+		for _, entry := range history {
+			fmt.Printf("%x  block %x  %s  received %d  sent %d\n",
+				entry.TxID, entry.BlockHash, time.Unix(entry.Timestamp, 0).Format(time.RFC3339), entry.Received, entry.Sent)
+		}
+	}
+}
+
+func (cli *CLI) send(from, account, to string, amount int, strategy, inputs string) {
+	if from != "" && !wallet.ValidateAddress(from, cli.params.Bech32HRP) {
+		fail(invalidAddress(from))
+	}
+	if !wallet.ValidateAddress(to, cli.params.Bech32HRP) {
+		fail(invalidAddress(to))
+	}
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
+	}
+	var opts blockchain.SendOptions
+	opts.Strategy, err = blockchain.CoinSelectorByName(strategy)
+	if err != nil {
+		fail(err)
+	}
+	if inputs != "" {
+		for _, input := range strings.Split(inputs, ",") {
+			outpoint, err := blockchain.ParseOutpoint(input)
+			if err != nil {
+				fail(err)
+			}
+			opts.Inputs = append(opts.Inputs, outpoint)
+		}
+	}
+	var tx *blockchain.Transaction
+	if from != "" {
+		tx, err = blockchain.NewUTXOTransaction(wallets, from, to, amount, bc, opts)
+	} else {
+		payments := []blockchain.Payment{{Address: to, Amount: amount}}
+		tx, err = blockchain.NewAccountTransaction(wallets, account, payments, bc, opts)
+	}
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		fail(err)
+	}
+
+	err = bc.AcceptTransaction(tx)
+	if err != nil {
+		fail(err)
+	}
+	_, err = bc.MineBlock([]*blockchain.Transaction{tx})
+	if err != nil {
+		fail(err)
+	}
 	fmt.Println("Success! Transaction sent.")
 }
 
+func (cli *CLI) sendMany(from, account, toJSON, strategy string) {
+	if from != "" && !wallet.ValidateAddress(from, cli.params.Bech32HRP) {
+		fail(invalidAddress(from))
+	}
+	var amounts map[string]int
+	err := json.Unmarshal([]byte(toJSON), &amounts)
+	if err != nil {
+		fail(err)
+	}
+	if len(amounts) == 0 {
+		fail(errors.New("no recipients given"))
+	}
+
+	// JSON objects are unordered; sort so the same request always builds
+	// the same outputs.
+	var payments []blockchain.Payment
+	for to, amount := range amounts {
+		if !wallet.ValidateAddress(to, cli.params.Bech32HRP) {
+			fail(invalidAddress(to))
+		}
+		payments = append(payments, blockchain.Payment{Address: to, Amount: amount})
+	}
+	sort.Slice(payments, func(i, j int) bool { return payments[i].Address < payments[j].Address })
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
+	}
+	selector, err := blockchain.CoinSelectorByName(strategy)
+	if err != nil {
+		fail(err)
+	}
+	opts := blockchain.SendOptions{Strategy: selector}
+	var tx *blockchain.Transaction
+	if from != "" {
+		tx, err = blockchain.NewBatchTransaction(wallets, from, payments, bc, opts)
+	} else {
+		tx, err = blockchain.NewAccountTransaction(wallets, account, payments, bc, opts)
+	}
+	if err != nil {
+		fail(err)
+	}
+	err = wallets.SaveToFile()
+	if err != nil {
+		fail(err)
+	}
+
+	err = bc.AcceptTransaction(tx)
+	if err != nil {
+		fail(err)
+	}
+	_, err = bc.MineBlock([]*blockchain.Transaction{tx})
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Success! Transaction %x paid %d recipients.\n", tx.ID, len(payments))
+}
+
 func (cli *CLI) mine(address string) {
-	if !wallet.ValidateAddress(address) {
-		log.Panic("ERROR: Address is not valid")
+	if !wallet.ValidateAddress(address, cli.params.Bech32HRP) {
+		fail(invalidAddress(address))
 	}
-	bc := blockchain.OpenBlockchain()
-	defer bc.CloseDB()
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
 
-	coinbaseTx := blockchain.NewCoinbaseTX(address, "Miner Reward")
+	coinbaseTx, err := blockchain.NewCoinbaseTX(address, "", cli.params.Bech32HRP)
+	if err != nil {
+		fail(err)
+	}
 
-	bc.MineBlock([]*blockchain.Transaction{coinbaseTx})
+	_, err = bc.MineBlock([]*blockchain.Transaction{coinbaseTx})
+	if err != nil {
+		fail(err)
+	}
 	fmt.Println("Success! New block mined and reward sent.")
 }
+
+func (cli *CLI) generate(n int, address string) {
+	if !wallet.ValidateAddress(address, cli.params.Bech32HRP) {
+		fail(invalidAddress(address))
+	}
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	blocks, err := bc.Generate(n, address)
+	for _, block := range blocks {
+		fmt.Printf("%x\n", block.Hash)
+	}
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Success! %d blocks mined.\n", n)
+}
+
+func (cli *CLI) migrateDB() {
+	version, err := blockchain.MigrateDB(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Done! Migrated the database from storage format %d.\n", version)
+}
+
+func (cli *CLI) getTransaction(txid string) {
+	id, err := hex.DecodeString(txid)
+	if err != nil {
+		fail(fmt.Errorf("invalid txid %q: %w", txid, err))
+	}
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	tx, err := bc.FindTransaction(id)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(tx)
+}
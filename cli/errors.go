@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+// Exit codes for the errors the blockchain API reports. Any other error exits
+// with exitFailure; 2 is left to the flag package for usage errors.
+const (
+	exitFailure           = 1
+	exitInsufficientFunds = 3
+	exitInvalidAddress    = 4
+	exitChainNotFound     = 5
+	exitChainExists       = 6
+	exitCorruptBlock      = 7
+	exitNeedsMigration    = 8
+	exitPruned            = 9
+	exitReindexing        = 10
+	exitMissingOutput     = 11
+	exitDoubleSpend       = 12
+	exitDuplicateTx       = 13
+)
+
+var exitCodes = []struct {
+	err  error
+	code int
+	hint string
+}{
+	{blockchain.ErrInsufficientFunds, exitInsufficientFunds, ""},
+	{blockchain.ErrInvalidAddress, exitInvalidAddress, ""},
+	{blockchain.ErrChainNotFound, exitChainNotFound, "Create one first with 'createblockchain'."},
+	{blockchain.ErrChainExists, exitChainExists, ""},
+	{blockchain.ErrCorruptBlock, exitCorruptBlock, ""},
+	{blockchain.ErrNeedsMigration, exitNeedsMigration, "Run 'migratedb' first."},
+	{blockchain.ErrPruned, exitPruned, "The chain is pruned; only recent blocks keep their transactions."},
+	{blockchain.ErrReindexing, exitReindexing, "Run 'reindex' to finish it."},
+	{blockchain.ErrMissingOutput, exitMissingOutput, ""},
+	{blockchain.ErrDoubleSpend, exitDoubleSpend, ""},
+	{blockchain.ErrDuplicateTransaction, exitDuplicateTx, ""},
+}
+
+// fail prints err and exits with the code for the kind of error it is.
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+	for _, e := range exitCodes {
+		if errors.Is(err, e.err) {
+			if e.hint != "" {
+				fmt.Fprintln(os.Stderr, e.hint)
+			}
+			os.Exit(e.code)
+		}
+	}
+	os.Exit(exitFailure)
+}
+
+func invalidAddress(address string) error {
+	return fmt.Errorf("%w: %s", blockchain.ErrInvalidAddress, address)
+}
+
+// pubKeyHashOf decodes address, exiting if it is malformed or belongs to
+// another network.
+func (cli *CLI) pubKeyHashOf(address string) []byte {
+	pubKeyHash, err := wallet.AddressToPubKeyHash(address, cli.params.Bech32HRP)
+	if err != nil {
+		fail(err)
+	}
+	return pubKeyHash
+}
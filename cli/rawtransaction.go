@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+// rawInput is the JSON form of an outpoint passed to createrawtransaction.
+// Address and Amount are only used by signrawtransaction -prevouts, to
+// describe the output being spent when the chain is not available.
+type rawInput struct {
+	Txid    string `json:"txid"`
+	Vout    int    `json:"vout"`
+	Address string `json:"address,omitempty"`
+	Amount  int    `json:"amount,omitempty"`
+}
+
+type rawOutput struct {
+	Address string `json:"address"`
+	Amount  int    `json:"amount"`
+}
+
+type decodedInput struct {
+	Txid      string `json:"txid"`
+	Vout      int    `json:"vout"`
+	Signature string `json:"signature"`
+	PubKey    string `json:"pubkey"`
+}
+
+type decodedTransaction struct {
+	Txid     string         `json:"txid"`
+	Version  int            `json:"version"`
+	Coinbase bool           `json:"coinbase"`
+	Vin      []decodedInput `json:"vin"`
+	Vout     []rawOutput    `json:"vout"`
+}
+
+func decodeHexTransaction(txHex string) *blockchain.Transaction {
+	data, err := hex.DecodeString(txHex)
+	if err != nil {
+		fail(err)
+	}
+	tx, err := blockchain.DeserializeTransaction(data)
+	if err != nil {
+		fail(err)
+	}
+	return tx
+}
+
+func (cli *CLI) createRawTransaction(inputsJSON, outputsJSON string) {
+	var rawInputs []rawInput
+	var rawOutputs []rawOutput
+	if err := json.Unmarshal([]byte(inputsJSON), &rawInputs); err != nil {
+		fail(err)
+	}
+	if err := json.Unmarshal([]byte(outputsJSON), &rawOutputs); err != nil {
+		fail(err)
+	}
+
+	var inputs []blockchain.Outpoint
+	for _, in := range rawInputs {
+		txid, err := hex.DecodeString(in.Txid)
+		if err != nil {
+			fail(err)
+		}
+		inputs = append(inputs, blockchain.Outpoint{Txid: txid, Vout: in.Vout})
+	}
+	var outputs []blockchain.TXOutput
+	for _, out := range rawOutputs {
+		output, err := blockchain.NewTXOutput(out.Amount, out.Address, cli.params.Bech32HRP)
+		if err != nil {
+			fail(err)
+		}
+		outputs = append(outputs, *output)
+	}
+
+	tx := blockchain.NewRawTransaction(inputs, outputs)
+	fmt.Println(hex.EncodeToString(tx.Serialize()))
+}
+
+func (cli *CLI) signRawTransaction(txHex, prevOutsJSON string) {
+	tx := decodeHexTransaction(txHex)
+	wallets, err := wallet.NewWallets()
+	if err != nil {
+		fail(err)
+	}
+
+	var prevOuts map[string]blockchain.TXOutput
+	if prevOutsJSON != "" {
+		var rawPrevOuts []rawInput
+		if err := json.Unmarshal([]byte(prevOutsJSON), &rawPrevOuts); err != nil {
+			fail(err)
+		}
+		prevOuts = make(map[string]blockchain.TXOutput)
+		for _, in := range rawPrevOuts {
+			txid, err := hex.DecodeString(in.Txid)
+			if err != nil {
+				fail(err)
+			}
+			outpoint := blockchain.Outpoint{Txid: txid, Vout: in.Vout}
+			prevOut, err := blockchain.NewTXOutput(in.Amount, in.Address, cli.params.Bech32HRP)
+			if err != nil {
+				fail(err)
+			}
+			prevOuts[outpoint.String()] = *prevOut
+		}
+	} else {
+		if !blockchain.ChainExists(cli.chainConfig()) {
+			fmt.Println("No existing blockchain found. Pass the outputs being spent with -prevouts.")
+			os.Exit(1)
+		}
+		bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+		if err != nil {
+			fail(err)
+		}
+		defer cli.closeChain(bc)
+		prevOuts, err = bc.PrevOutputs(tx)
+		if err != nil {
+			fail(err)
+		}
+	}
+
+	err = tx.Sign(wallets, prevOuts)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(hex.EncodeToString(tx.Serialize()))
+}
+
+func (cli *CLI) decodeRawTransaction(txHex string) {
+	tx := decodeHexTransaction(txHex)
+
+	decoded := decodedTransaction{
+		Txid:     hex.EncodeToString(tx.ID),
+		Version:  tx.Version,
+		Coinbase: tx.IsCoinbase(),
+		Vin:      []decodedInput{},
+		Vout:     []rawOutput{},
+	}
+	for _, in := range tx.Vin {
+		decoded.Vin = append(decoded.Vin, decodedInput{
+			Txid:      hex.EncodeToString(in.Txid),
+			Vout:      in.Vout,
+			Signature: hex.EncodeToString(in.Signature),
+			PubKey:    hex.EncodeToString(in.PubKey),
+		})
+	}
+	for _, out := range tx.Vout {
+		decoded.Vout = append(decoded.Vout, rawOutput{
+			Address: wallet.PubKeyHashToAddress(out.ScriptPubKey),
+			Amount:  out.Value,
+		})
+	}
+
+	out, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		fail(err)
+	}
+	fmt.Println(string(out))
+}
+
+func (cli *CLI) sendRawTransaction(txHex string) {
+	tx := decodeHexTransaction(txHex)
+
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	err = bc.AcceptTransaction(tx)
+	if err != nil {
+		fail(err)
+	}
+	_, err = bc.MineBlock([]*blockchain.Transaction{tx})
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Success! Transaction %x sent.\n", tx.ID)
+}
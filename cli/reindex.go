@@ -0,0 +1,18 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+)
+
+func (cli *CLI) reindex() {
+	blocks, err := blockchain.ReindexBlockchain(cli.chainConfig(), func(height, total int) {
+		fmt.Printf("\rReindexed %d/%d blocks", height, total)
+	})
+	fmt.Println()
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("Reindexed %d blocks; chainwork and the UTXO set were rebuilt.\n", blocks)
+}
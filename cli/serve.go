@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/notify"
+)
+
+// serve holds the chain open and serves notifications until interrupted.
+// Other commands can't open the database meanwhile, so transactions are
+// submitted over HTTP instead.
+func (cli *CLI) serve(listen string) {
+	bc, err := blockchain.LoadBlockchain(cli.chainConfig())
+	if err != nil {
+		fail(err)
+	}
+	defer cli.closeChain(bc)
+
+	server := notify.NewServer(bc)
+	go server.Run()
+
+	httpServer := &http.Server{Addr: listen, Handler: server.Handler()}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		_ = httpServer.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("Serving notifications on ws://%s/ws\n", listen)
+	err = httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		cli.closeChain(bc)
+		fail(err)
+	}
+}
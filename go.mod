@@ -2,7 +2,10 @@ module github.com/Triad-0112/BlockChain.git
 
 go 1.24.0
 
-require github.com/dgraph-io/badger/v3 v3.2103.5
+require (
+	github.com/dgraph-io/badger/v3 v3.2103.5
+	go.etcd.io/bbolt v1.4.3
+)
 
 require (
 	github.com/cespare/xxhash v1.1.0 // indirect
@@ -19,6 +22,6 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	go.opencensus.io v0.22.5 // indirect
 	golang.org/x/crypto v0.43.0
-	golang.org/x/net v0.45.0 // indirect
+	golang.org/x/net v0.45.0
 	golang.org/x/sys v0.37.0 // indirect
 )
@@ -0,0 +1,311 @@
+// Package notify pushes chain and mempool events to WebSocket clients as
+// JSON, so front-ends can follow blocks, addresses and transactions live.
+//
+// A client sends requests of the form
+//
+//	{"method": "subscribe", "blocks": true, "addresses": ["ADDRESS"], "txids": ["TXID"]}
+//
+// and "unsubscribe" with the same fields. Every request is answered with
+// {"result": "ok"} or {"error": "..."}. Notifications are
+//
+//	{"type": "block", "hash": "...", "txids": [...]}
+//	{"type": "tx", "status": "mempool"|"confirmed", "txid": "...", "block": "...", "addresses": [...]}
+//
+// where addresses lists the subscribed addresses the transaction pays to or
+// spends from.
+package notify
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+// sendQueueLen is how many notifications may wait for a client before it is
+// dropped as too slow.
+const sendQueueLen = 256
+
+type request struct {
+	Method    string   `json:"method"`
+	Blocks    bool     `json:"blocks"`
+	Addresses []string `json:"addresses"`
+	Txids     []string `json:"txids"`
+}
+
+type response struct {
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Notification is the JSON message sent for a block or transaction.
+type Notification struct {
+	Type      string   `json:"type"`
+	Hash      string   `json:"hash,omitempty"`
+	Txids     []string `json:"txids,omitempty"`
+	Status    string   `json:"status,omitempty"`
+	Txid      string   `json:"txid,omitempty"`
+	Block     string   `json:"block,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// Server relays the events of one chain to its WebSocket clients.
+type Server struct {
+	bc      *blockchain.Blockchain
+	events  <-chan blockchain.Event
+	cancel  func()
+	mu      sync.Mutex
+	clients map[*client]bool
+}
+
+// client is one WebSocket connection and what it subscribed to. Addresses
+// are keyed by public key hash, so both address formats match.
+type client struct {
+	conn      *websocket.Conn
+	send      chan interface{}
+	hrp       string
+	mu        sync.Mutex
+	blocks    bool
+	addresses map[string]string
+	txids     map[string]bool
+}
+
+// NewServer returns a server for bc, subscribed to its events from then on.
+// Call Run to start relaying them.
+func NewServer(bc *blockchain.Blockchain) *Server {
+	events, cancel := bc.Subscribe()
+	return &Server{bc: bc, events: events, cancel: cancel, clients: make(map[*client]bool)}
+}
+
+// Handler serves WebSocket subscriptions on /ws.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/ws", websocket.Handler(s.serveWS))
+	return mux
+}
+
+// Run relays chain events to clients until the chain is closed.
+func (s *Server) Run() {
+	defer s.cancel()
+	for event := range s.events {
+		switch e := event.(type) {
+		case blockchain.BlockConnected:
+			s.blockConnected(e.Block)
+		case blockchain.TxAcceptedToMempool:
+			s.broadcastTx(e.Tx, "mempool", nil)
+		}
+	}
+}
+
+func (s *Server) blockConnected(block *blockchain.Block) {
+	n := Notification{Type: "block", Hash: hex.EncodeToString(block.Hash)}
+	for _, tx := range block.Transactions {
+		n.Txids = append(n.Txids, hex.EncodeToString(tx.ID))
+	}
+	for _, c := range s.clientList() {
+		c.mu.Lock()
+		blocks := c.blocks
+		c.mu.Unlock()
+		if blocks {
+			s.queue(c, n)
+		}
+	}
+	for _, tx := range block.Transactions {
+		s.broadcastTx(tx, "confirmed", block.Hash)
+	}
+}
+
+func (s *Server) broadcastTx(tx *blockchain.Transaction, status string, blockHash []byte) {
+	for _, c := range s.clientList() {
+		if n, ok := c.match(tx); ok {
+			n.Status = status
+			if blockHash != nil {
+				n.Block = hex.EncodeToString(blockHash)
+			}
+			s.queue(c, n)
+		}
+	}
+}
+
+// match reports whether c subscribed to tx, by txid or by an address it
+// pays to or spends from.
+func (c *client) match(tx *blockchain.Transaction) (Notification, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	txid := hex.EncodeToString(tx.ID)
+	n := Notification{Type: "tx", Txid: txid}
+	matched := c.txids[txid]
+	for key, address := range c.addresses {
+		pubKeyHash, _ := hex.DecodeString(key)
+		if touches(tx, pubKeyHash) {
+			n.Addresses = append(n.Addresses, address)
+			matched = true
+		}
+	}
+	sort.Strings(n.Addresses)
+	return n, matched
+}
+
+func touches(tx *blockchain.Transaction, pubKeyHash []byte) bool {
+	for _, out := range tx.Vout {
+		if out.CanBeUnlockedWith(pubKeyHash) {
+			return true
+		}
+	}
+	if tx.IsCoinbase() {
+		return false
+	}
+	for _, in := range tx.Vin {
+		if in.CanUnlockOutputWith(pubKeyHash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) clientList() []*client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var clients []*client
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+// queue hands msg to c's writer, dropping the client if it has fallen too far
+// behind rather than holding up everyone else. It reports false if the
+// client is gone.
+func (s *Server) queue(c *client, msg interface{}) bool {
+	s.mu.Lock()
+	if !s.clients[c] {
+		s.mu.Unlock()
+		return false
+	}
+	select {
+	case c.send <- msg:
+		s.mu.Unlock()
+		return true
+	default:
+		s.mu.Unlock()
+		s.drop(c)
+		return false
+	}
+}
+
+func (s *Server) drop(c *client) {
+	s.mu.Lock()
+	if s.clients[c] {
+		delete(s.clients, c)
+		close(c.send)
+	}
+	s.mu.Unlock()
+	_ = c.conn.Close()
+}
+
+func (s *Server) serveWS(conn *websocket.Conn) {
+	c := &client{
+		conn:      conn,
+		send:      make(chan interface{}, sendQueueLen),
+		hrp:       s.bc.Params().Bech32HRP,
+		addresses: make(map[string]string),
+		txids:     make(map[string]bool),
+	}
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer s.drop(c)
+
+	go func() {
+		for msg := range c.send {
+			if err := websocket.JSON.Send(conn, msg); err != nil {
+				_ = conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		var req request
+		err := websocket.JSON.Receive(conn, &req)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if err != nil && !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr) {
+			// The connection is closed or broken.
+			return
+		}
+		if err != nil {
+			if !s.queue(c, response{Error: fmt.Sprintf("malformed request: %v", err)}) {
+				return
+			}
+			continue
+		}
+		resp := response{Result: "ok"}
+		if err := c.handle(req); err != nil {
+			resp = response{Error: err.Error()}
+		}
+		if !s.queue(c, resp) {
+			return
+		}
+	}
+}
+
+func (c *client) handle(req request) error {
+	var subscribe bool
+	switch req.Method {
+	case "subscribe":
+		subscribe = true
+	case "unsubscribe":
+	default:
+		return fmt.Errorf("unknown method %q", req.Method)
+	}
+
+	// Check everything before changing anything, so a bad request has no
+	// effect.
+	pubKeyHashes := make([]string, len(req.Addresses))
+	for i, address := range req.Addresses {
+		pubKeyHash, err := wallet.AddressToPubKeyHash(address, c.hrp)
+		if err != nil {
+			return err
+		}
+		pubKeyHashes[i] = hex.EncodeToString(pubKeyHash)
+	}
+	txids := make([]string, len(req.Txids))
+	for i, txid := range req.Txids {
+		id, err := hex.DecodeString(txid)
+		if err != nil {
+			return fmt.Errorf("invalid txid %q: %w", txid, err)
+		}
+		txids[i] = hex.EncodeToString(id)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if req.Blocks {
+		c.blocks = subscribe
+	}
+	for i, key := range pubKeyHashes {
+		if subscribe {
+			c.addresses[key] = req.Addresses[i]
+		} else {
+			delete(c.addresses, key)
+		}
+	}
+	for _, txid := range txids {
+		if subscribe {
+			c.txids[txid] = true
+		} else {
+			delete(c.txids, txid)
+		}
+	}
+	return nil
+}
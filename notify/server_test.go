@@ -0,0 +1,77 @@
+package notify_test
+
+import (
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/Triad-0112/BlockChain.git/notify"
+	"github.com/Triad-0112/BlockChain.git/testutil"
+)
+
+type reply struct {
+	Result string `json:"result"`
+	Error  string `json:"error"`
+}
+
+func receive(t *testing.T, ws *websocket.Conn, v interface{}) {
+	t.Helper()
+	if err := ws.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.JSON.Receive(ws, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerNotifiesSubscribers(t *testing.T) {
+	h := testutil.NewHarness(t)
+	address := h.NewAddress()
+	server := notify.NewServer(h.Chain)
+	go server.Run()
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var resp reply
+	if err := websocket.JSON.Send(ws, map[string]interface{}{"method": "watch"}); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, ws, &resp)
+	if !strings.Contains(resp.Error, "unknown method") {
+		t.Fatalf("reply to an unknown method = %+v, want an error", resp)
+	}
+	err = websocket.JSON.Send(ws, map[string]interface{}{"method": "subscribe", "blocks": true, "addresses": []string{address}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = reply{}
+	receive(t, ws, &resp)
+	if resp.Result != "ok" {
+		t.Fatalf("reply to subscribe = %+v, want ok", resp)
+	}
+
+	block := h.Generate(1, address)[0]
+	hash := hex.EncodeToString(block.Hash)
+	txid := hex.EncodeToString(block.Transactions[0].ID)
+
+	var n notify.Notification
+	receive(t, ws, &n)
+	if n.Type != "block" || n.Hash != hash || len(n.Txids) != 1 || n.Txids[0] != txid {
+		t.Errorf("block notification = %+v, want block %s with txid %s", n, hash, txid)
+	}
+	n = notify.Notification{}
+	receive(t, ws, &n)
+	if n.Type != "tx" || n.Status != "confirmed" || n.Txid != txid || n.Block != hash ||
+		len(n.Addresses) != 1 || n.Addresses[0] != address {
+		t.Errorf("tx notification = %+v, want %s confirmed in %s paying %s", n, txid, hash, address)
+	}
+}
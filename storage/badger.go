@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+type badgerStore struct {
+	db *badger.DB
+}
+
+// OpenBadger opens or creates a Badger store in the directory path.
+func OpenBadger(path string) (Store, error) {
+	opts := badger.DefaultOptions(path)
+	opts.Logger = nil
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &badgerStore{db}, nil
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+func (t badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
+
+func (t badgerTxn) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := t.txn.NewIterator(opts)
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+		err := item.Value(func(val []byte) error {
+			return fn(item.Key(), val)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t badgerTxn) Put(key, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
+
+func (s *badgerStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		value, err = badgerTxn{txn}.Get(key)
+		return err
+	})
+	return value, err
+}
+
+func (s *badgerStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		return badgerTxn{txn}.Iterate(prefix, fn)
+	})
+}
+
+func (s *badgerStore) Put(key, value []byte) error {
+	return s.Batch(func(b Batch) error { return b.Put(key, value) })
+}
+
+func (s *badgerStore) Delete(key []byte) error {
+	return s.Batch(func(b Batch) error { return b.Delete(key) })
+}
+
+func (s *badgerStore) Batch(fn func(Batch) error) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return fn(badgerTxn{txn})
+	})
+}
+
+func (s *badgerStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltFile is the name of the database file inside a bbolt store's directory.
+const boltFile = "chain.bolt"
+
+// boltLockTimeout is how long OpenBolt waits for another process holding the
+// file, such as a running node, to let go of it.
+const boltLockTimeout = time.Second
+
+var boltBucket = []byte("chain")
+
+type boltStore struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates a bbolt store in the directory path. Everything
+// is kept in one bucket of a single file.
+func OpenBolt(path string) (Store, error) {
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, err
+	}
+	file := filepath.Join(path, boltFile)
+	db, err := bolt.Open(file, 0644, &bolt.Options{Timeout: boltLockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is locked by another process: %w", file, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &boltStore{db}, nil
+}
+
+type boltTx struct {
+	bucket *bolt.Bucket
+}
+
+func (t boltTx) Get(key []byte) ([]byte, error) {
+	value := t.bucket.Get(key)
+	if value == nil {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (t boltTx) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	c := t.bucket.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		if err := fn(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t boltTx) Put(key, value []byte) error {
+	// bbolt treats a nil value as missing, so store empty values as empty
+	// slices.
+	if value == nil {
+		value = []byte{}
+	}
+	return t.bucket.Put(key, value)
+}
+
+func (t boltTx) Delete(key []byte) error {
+	return t.bucket.Delete(key)
+}
+
+func (s *boltStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		value, err = boltTx{tx.Bucket(boltBucket)}.Get(key)
+		return err
+	})
+	return value, err
+}
+
+func (s *boltStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return boltTx{tx.Bucket(boltBucket)}.Iterate(prefix, fn)
+	})
+}
+
+func (s *boltStore) Put(key, value []byte) error {
+	return s.Batch(func(b Batch) error { return b.Put(key, value) })
+}
+
+func (s *boltStore) Delete(key []byte) error {
+	return s.Batch(func(b Batch) error { return b.Delete(key) })
+}
+
+func (s *boltStore) Batch(fn func(Batch) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx.Bucket(boltBucket)})
+	})
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memoryStore struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+// NewMemory returns an empty store that lives only in memory.
+func NewMemory() Store {
+	return &memoryStore{data: make(map[string][]byte)}
+}
+
+type kv struct {
+	key, value []byte
+}
+
+// snapshot returns copies of the entries under prefix in key order, so
+// callbacks run without the lock held and may write to the store.
+func (s *memoryStore) snapshot(prefix []byte) []kv {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var entries []kv
+	for k, v := range s.data {
+		if strings.HasPrefix(k, string(prefix)) {
+			entries = append(entries, kv{[]byte(k), append([]byte{}, v...)})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+	return entries
+}
+
+func (s *memoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (s *memoryStore) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	for _, e := range s.snapshot(prefix) {
+		if err := fn(e.key, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Put(key, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (s *memoryStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, string(key))
+	return nil
+}
+
+// Batch holds the store's write lock while fn runs, so batches are applied
+// one at a time and never seen half done.
+func (s *memoryStore) Batch(fn func(Batch) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := &memoryBatch{store: s, writes: make(map[string][]byte)}
+	if err := fn(b); err != nil {
+		return err
+	}
+	for k, v := range b.writes {
+		if v == nil {
+			delete(s.data, k)
+		} else {
+			s.data[k] = v
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// memoryBatch records writes over the store's data; a nil value marks a
+// deletion. The store's lock is held throughout.
+type memoryBatch struct {
+	store  *memoryStore
+	writes map[string][]byte
+}
+
+func (b *memoryBatch) Get(key []byte) ([]byte, error) {
+	value, ok := b.writes[string(key)]
+	if !ok {
+		value, ok = b.store.data[string(key)]
+	}
+	if !ok || value == nil {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (b *memoryBatch) Iterate(prefix []byte, fn func(key, value []byte) error) error {
+	merged := make(map[string][]byte)
+	for k, v := range b.store.data {
+		if strings.HasPrefix(k, string(prefix)) {
+			merged[k] = v
+		}
+	}
+	for k, v := range b.writes {
+		if strings.HasPrefix(k, string(prefix)) {
+			merged[k] = v
+		}
+	}
+	var keys []string
+	for k, v := range merged {
+		if v != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), append([]byte{}, merged[k]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *memoryBatch) Put(key, value []byte) error {
+	b.writes[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	b.writes[string(key)] = nil
+	return nil
+}
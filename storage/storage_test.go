@@ -0,0 +1,50 @@
+package storage_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+	"github.com/Triad-0112/BlockChain.git/storage/storagetest"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		return storage.NewMemory()
+	})
+}
+
+func TestBadger(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := storage.OpenBadger(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestBolt(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Store {
+		s, err := storage.OpenBolt(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	})
+}
+
+func TestBoltLocked(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.OpenBolt(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	_, err = storage.OpenBolt(dir)
+	if !errors.Is(err, bolt.ErrTimeout) {
+		t.Fatalf("opening a locked store: got %v, want a timeout", err)
+	}
+}
@@ -0,0 +1,232 @@
+// Package storagetest checks that a storage.Store implementation behaves the
+// way the blockchain relies on. Every backend should pass Run.
+package storagetest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Triad-0112/BlockChain.git/storage"
+)
+
+// Run runs the conformance suite against stores returned by open, which must
+// return a new, empty store each time it is called. Stores are closed by the
+// suite.
+func Run(t *testing.T, open func(t *testing.T) storage.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s storage.Store)
+	}{
+		{"GetMissing", testGetMissing},
+		{"PutGet", testPutGet},
+		{"Overwrite", testOverwrite},
+		{"Delete", testDelete},
+		{"EmptyValue", testEmptyValue},
+		{"ValuesAreCopies", testValuesAreCopies},
+		{"Iterate", testIterate},
+		{"IterateStops", testIterateStops},
+		{"BatchCommits", testBatchCommits},
+		{"BatchRollsBack", testBatchRollsBack},
+		{"BatchReadsOwnWrites", testBatchReadsOwnWrites},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := open(t)
+			defer func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close: %v", err)
+				}
+			}()
+			test.fn(t, s)
+		})
+	}
+}
+
+func mustPut(t *testing.T, s storage.Store, key, value string) {
+	t.Helper()
+	if err := s.Put([]byte(key), []byte(value)); err != nil {
+		t.Fatalf("Put(%q): %v", key, err)
+	}
+}
+
+// expect checks that key holds value, or is not set if value is nil.
+func expect(t *testing.T, r storage.Reader, key string, value []byte) {
+	t.Helper()
+	got, err := r.Get([]byte(key))
+	if value == nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("Get(%q) = %q, %v; want ErrNotFound", key, got, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	if !bytes.Equal(got, value) {
+		t.Fatalf("Get(%q) = %q, want %q", key, got, value)
+	}
+}
+
+// collect returns the keys and values under prefix as "key=value" strings.
+func collect(t *testing.T, r storage.Reader, prefix string) []string {
+	t.Helper()
+	var entries []string
+	err := r.Iterate([]byte(prefix), func(key, value []byte) error {
+		entries = append(entries, fmt.Sprintf("%s=%s", key, value))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Iterate(%q): %v", prefix, err)
+	}
+	return entries
+}
+
+func expectEntries(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got entries %q, want %q", got, want)
+	}
+}
+
+func testGetMissing(t *testing.T, s storage.Store) {
+	expect(t, s, "missing", nil)
+}
+
+func testPutGet(t *testing.T, s storage.Store) {
+	mustPut(t, s, "a", "1")
+	mustPut(t, s, "b", "2")
+	expect(t, s, "a", []byte("1"))
+	expect(t, s, "b", []byte("2"))
+}
+
+func testOverwrite(t *testing.T, s storage.Store) {
+	mustPut(t, s, "a", "1")
+	mustPut(t, s, "a", "2")
+	expect(t, s, "a", []byte("2"))
+}
+
+func testDelete(t *testing.T, s storage.Store) {
+	mustPut(t, s, "a", "1")
+	if err := s.Delete([]byte("a")); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	expect(t, s, "a", nil)
+	if err := s.Delete([]byte("never-set")); err != nil {
+		t.Fatalf("deleting a missing key: %v", err)
+	}
+}
+
+func testEmptyValue(t *testing.T, s storage.Store) {
+	if err := s.Put([]byte("empty"), nil); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	expect(t, s, "empty", []byte{})
+	expectEntries(t, collect(t, s, "empty"), "empty=")
+}
+
+func testValuesAreCopies(t *testing.T, s storage.Store) {
+	value := []byte("value")
+	if err := s.Put([]byte("a"), value); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	value[0] = 'X'
+	got, err := s.Get([]byte("a"))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got[0] = 'Y'
+	expect(t, s, "a", []byte("value"))
+}
+
+func testIterate(t *testing.T, s storage.Store) {
+	for _, key := range []string{"b2", "a1", "b1", "b", "c1", "b\xff"} {
+		mustPut(t, s, key, "v"+key)
+	}
+	expectEntries(t, collect(t, s, "b"), "b=vb", "b1=vb1", "b2=vb2", "b\xff=vb\xff")
+	expectEntries(t, collect(t, s, "d"))
+	if got := collect(t, s, ""); len(got) != 6 {
+		t.Fatalf("iterating everything returned %d entries, want 6", len(got))
+	}
+}
+
+func testIterateStops(t *testing.T, s storage.Store) {
+	mustPut(t, s, "a1", "1")
+	mustPut(t, s, "a2", "2")
+	stop := errors.New("stop")
+	calls := 0
+	err := s.Iterate([]byte("a"), func(key, value []byte) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) {
+		t.Fatalf("Iterate returned %v, want the callback's error", err)
+	}
+	if calls != 1 {
+		t.Fatalf("callback called %d times after failing, want 1", calls)
+	}
+}
+
+func testBatchCommits(t *testing.T, s storage.Store) {
+	mustPut(t, s, "old", "1")
+	err := s.Batch(func(b storage.Batch) error {
+		if err := b.Put([]byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("b"), []byte("2")); err != nil {
+			return err
+		}
+		return b.Delete([]byte("old"))
+	})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	expect(t, s, "a", []byte("1"))
+	expect(t, s, "b", []byte("2"))
+	expect(t, s, "old", nil)
+}
+
+func testBatchRollsBack(t *testing.T, s storage.Store) {
+	mustPut(t, s, "keep", "1")
+	fail := errors.New("fail")
+	err := s.Batch(func(b storage.Batch) error {
+		if err := b.Put([]byte("a"), []byte("1")); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte("keep")); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Fatalf("Batch returned %v, want fn's error", err)
+	}
+	expect(t, s, "a", nil)
+	expect(t, s, "keep", []byte("1"))
+}
+
+func testBatchReadsOwnWrites(t *testing.T, s storage.Store) {
+	mustPut(t, s, "k1", "old")
+	mustPut(t, s, "k2", "gone")
+	err := s.Batch(func(b storage.Batch) error {
+		if err := b.Put([]byte("k1"), []byte("new")); err != nil {
+			return err
+		}
+		if err := b.Put([]byte("k3"), []byte("added")); err != nil {
+			return err
+		}
+		if err := b.Delete([]byte("k2")); err != nil {
+			return err
+		}
+		expect(t, b, "k1", []byte("new"))
+		expect(t, b, "k2", nil)
+		expect(t, b, "k3", []byte("added"))
+		expectEntries(t, collect(t, b, "k"), "k1=new", "k3=added")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	expectEntries(t, collect(t, s, "k"), "k1=new", "k3=added")
+}
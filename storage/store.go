@@ -0,0 +1,76 @@
+// Package storage defines the key-value store the blockchain is kept in and
+// provides Badger, bbolt and in-memory implementations of it.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNotFound is returned by Get when a key is not set.
+var ErrNotFound = errors.New("key not found")
+
+// Backend names, as accepted by Open.
+const (
+	Badger = "badger"
+	Bolt   = "bbolt"
+	Memory = "memory"
+)
+
+// Reader reads keys. Values returned by Get belong to the caller; values
+// passed to an Iterate callback are only valid until it returns.
+type Reader interface {
+	Get(key []byte) ([]byte, error)
+	// Iterate calls fn for every key starting with prefix, in ascending
+	// key order, stopping at the first error fn returns.
+	Iterate(prefix []byte, fn func(key, value []byte) error) error
+}
+
+// Batch is a group of writes applied together. Reads through a batch see
+// its own writes.
+type Batch interface {
+	Reader
+	Put(key, value []byte) error
+	Delete(key []byte) error
+}
+
+// Store is a persistent, ordered key-value store. Deleting a missing key is
+// not an error.
+type Store interface {
+	Reader
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// Batch runs fn and applies its writes atomically if it returns nil.
+	// If fn fails, none of them are applied.
+	Batch(fn func(Batch) error) error
+	Close() error
+}
+
+// Open opens or creates the store of the given backend at path, a directory.
+// The memory backend ignores path.
+func Open(backend, path string) (Store, error) {
+	switch backend {
+	case Badger:
+		return OpenBadger(path)
+	case Bolt:
+		return OpenBolt(path)
+	case Memory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q; use %s, %s or %s", backend, Badger, Bolt, Memory)
+	}
+}
+
+// Detect reports which backend the store at path was created with, or ""
+// if there is none yet.
+func Detect(path string) string {
+	if _, err := os.Stat(filepath.Join(path, boltFile)); err == nil {
+		return Bolt
+	}
+	if _, err := os.Stat(filepath.Join(path, "MANIFEST")); err == nil {
+		return Badger
+	}
+	return ""
+}
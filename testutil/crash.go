@@ -0,0 +1,59 @@
+package testutil
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+)
+
+// ErrCrash is returned by the write a crash was injected into.
+var ErrCrash = errors.New("injected crash")
+
+// crashPoint is the failure armed by CrashAt. It fires once.
+type crashPoint struct {
+	mu    sync.Mutex
+	point blockchain.FailPoint
+}
+
+func (c *crashPoint) hit(point blockchain.FailPoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.point != point {
+		return nil
+	}
+	c.point = ""
+	return ErrCrash
+}
+
+// CrashAt makes the next write that reaches point stop there with ErrCrash,
+// as if the process had died. Follow it with Restart to see what a real
+// crash would have left on disk.
+func (h *Harness) CrashAt(point blockchain.FailPoint) {
+	h.crash.mu.Lock()
+	h.crash.point = point
+	h.crash.mu.Unlock()
+}
+
+// Restart closes the chain cleanly and opens it again from disk, running the
+// startup consistency check. It only works on a disk harness.
+func (h *Harness) Restart() {
+	h.t.Helper()
+	if h.inMemory {
+		h.t.Fatal("Restart needs a harness from NewDiskHarness")
+	}
+	h.Chain.CloseDB()
+	chain, err := blockchain.LoadBlockchain(h.Config())
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.Chain = chain
+}
+
+// Crash closes the chain without writing out the UTXO changes held in its
+// cache, as if the process had died, and opens it again from disk.
+func (h *Harness) Crash() {
+	h.t.Helper()
+	h.CrashAt(blockchain.FailBeforeFlush)
+	h.Restart()
+}
@@ -0,0 +1,164 @@
+// Package testutil spins up throwaway regtest chains and wallets for tests.
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Triad-0112/BlockChain.git/blockchain"
+	"github.com/Triad-0112/BlockChain.git/wallet"
+)
+
+// blockReward is the value of every coinbase output.
+const blockReward = 100
+
+// Harness is a regtest chain plus a wallet file living in a temporary
+// directory. Everything is removed when the test finishes.
+type Harness struct {
+	t       testing.TB
+	Dir     string
+	Chain   *blockchain.Blockchain
+	Wallets *wallet.Wallets
+	// Miner owns the genesis reward and is the default recipient of
+	// blocks mined by Generate.
+	Miner string
+	// Clock is the chain's clock. It starts at the wall-clock time the
+	// harness was created and only moves when advanced.
+	Clock *ManualClock
+
+	inMemory bool
+	backend  string
+	crash    crashPoint
+}
+
+// NewHarness returns a harness whose chain is kept in memory.
+func NewHarness(t testing.TB) *Harness {
+	return newHarness(t, true, "")
+}
+
+// NewDiskHarness returns a harness whose chain is stored in Badger under Dir,
+// for tests that need to close and reopen the database.
+func NewDiskHarness(t testing.TB) *Harness {
+	return newHarness(t, false, "")
+}
+
+// NewBackendHarness is like NewDiskHarness but stores the chain with the
+// named storage backend.
+func NewBackendHarness(t testing.TB, backend string) *Harness {
+	return newHarness(t, false, backend)
+}
+
+func newHarness(t testing.TB, inMemory bool, backend string) *Harness {
+	t.Helper()
+	dir := t.TempDir()
+
+	wallets, _ := wallet.NewWalletsFromFile(filepath.Join(dir, "wallets.dat"))
+	h := &Harness{
+		t:        t,
+		Dir:      dir,
+		Wallets:  wallets,
+		Clock:    NewManualClock(time.Now()),
+		inMemory: inMemory,
+		backend:  backend,
+	}
+	h.Miner = h.NewAddress()
+	chain, err := blockchain.CreateBlockchain(h.Miner, h.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Chain = chain
+	t.Cleanup(func() {
+		h.Chain.CloseDB()
+	})
+	return h
+}
+
+// Config returns the chain configuration the harness was created with.
+func (h *Harness) Config() blockchain.Config {
+	return blockchain.Config{
+		Params:    &blockchain.RegTestParams,
+		DBPath:    filepath.Join(h.Dir, "blocks"),
+		InMemory:  h.inMemory,
+		Backend:   h.backend,
+		Clock:     h.Clock.Now,
+		FailPoint: h.crash.hit,
+	}
+}
+
+// NewAddress creates a wallet, saves the wallet file and returns its address.
+func (h *Harness) NewAddress() string {
+	h.t.Helper()
+	address, err := h.Wallets.CreateWallet()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	err = h.Wallets.SaveToFile()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return address
+}
+
+// Generate mines n blocks paying their rewards to address.
+func (h *Harness) Generate(n int, address string) []*blockchain.Block {
+	h.t.Helper()
+	blocks, err := h.Chain.Generate(n, address)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return blocks
+}
+
+// FundedAddress creates a new address and mines enough blocks to it for its
+// balance to reach at least amount.
+func (h *Harness) FundedAddress(amount int) string {
+	h.t.Helper()
+	address := h.NewAddress()
+	h.Generate((amount+blockReward-1)/blockReward, address)
+	return address
+}
+
+// Balance sums the unspent outputs locked to address, including its change
+// addresses if it belongs to the harness wallet.
+func (h *Harness) Balance(address string) int {
+	h.t.Helper()
+	addresses := []string{address}
+	if _, ok := h.Wallets.Wallets[address]; ok {
+		addresses = h.Wallets.OwnedAddresses(address)
+	}
+	balance := 0
+	for _, address := range addresses {
+		utxos, err := h.Chain.FindUTXO(address)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		for _, out := range utxos {
+			balance += out.Value
+		}
+	}
+	return balance
+}
+
+// Send builds a payment from one wallet address to another with the default
+// coin selection, accepts it to the mempool and mines it into a block.
+func (h *Harness) Send(from, to string, amount int) *blockchain.Transaction {
+	h.t.Helper()
+	tx, err := blockchain.NewUTXOTransaction(h.Wallets, from, to, amount, h.Chain, blockchain.SendOptions{})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	err = h.Wallets.SaveToFile()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	err = h.Chain.AcceptTransaction(tx)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	_, err = h.Chain.MineBlock([]*blockchain.Transaction{tx})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return tx
+}
@@ -2,11 +2,21 @@ package utils
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
 	"math/big"
 )
 
 var b58Alphabet = []byte("123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz")
 
+// checksumLen is the number of double-SHA256 bytes Base58Check appends.
+const checksumLen = 4
+
+// ErrChecksum is returned by Base58CheckDecode and Bech32Decode when the
+// checksum does not match the data.
+var ErrChecksum = errors.New("checksum mismatch")
+
 func Base58Encode(input []byte) []byte {
 	var result []byte
 	x := big.NewInt(0).SetBytes(input)
@@ -34,18 +44,54 @@ func Base58Encode(input []byte) []byte {
 	return result
 }
 
-func Base58Decode(input []byte) []byte {
+// Base58Decode reverses Base58Encode. Every leading '1' stands for a leading
+// zero byte.
+func Base58Decode(input []byte) ([]byte, error) {
 	result := big.NewInt(0)
-	for _, b := range input {
+	for i, b := range input {
 		charIndex := bytes.IndexByte(b58Alphabet, b)
+		if charIndex < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q at position %d", b, i)
+		}
 		result.Mul(result, big.NewInt(58))
 		result.Add(result, big.NewInt(int64(charIndex)))
 	}
 
-	decoded := result.Bytes()
-	if input[0] == '1' {
-		decoded = append([]byte{0x00}, decoded...)
+	zeros := 0
+	for zeros < len(input) && input[zeros] == b58Alphabet[0] {
+		zeros++
 	}
+	decoded := append(make([]byte, zeros), result.Bytes()...)
+
+	return decoded, nil
+}
+
+// Base58CheckEncode encodes version and payload followed by the first four
+// bytes of their double SHA-256, as used for addresses and exported keys.
+func Base58CheckEncode(version byte, payload []byte) []byte {
+	versionedPayload := append([]byte{version}, payload...)
+	fullPayload := append(versionedPayload, checksum(versionedPayload)...)
+	return Base58Encode(fullPayload)
+}
+
+// Base58CheckDecode reverses Base58CheckEncode, verifying the checksum.
+func Base58CheckDecode(input []byte) (byte, []byte, error) {
+	decoded, err := Base58Decode(input)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(decoded) < 1+checksumLen {
+		return 0, nil, fmt.Errorf("base58check data is %d bytes, too short for a version and checksum", len(decoded))
+	}
+	versionedPayload := decoded[:len(decoded)-checksumLen]
+	if !bytes.Equal(decoded[len(versionedPayload):], checksum(versionedPayload)) {
+		return 0, nil, ErrChecksum
+	}
+	return versionedPayload[0], versionedPayload[1:], nil
+}
 
-	return decoded
+func checksum(payload []byte) []byte {
+	firstSHA := sha256.Sum256(payload)
+	secondSHA := sha256.Sum256(firstSHA[:])
+	return secondSHA[:checksumLen]
 }
@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBase58Decode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string // hex
+		err   string
+	}{
+		{"", "", ""},
+		{"1", "00", ""},
+		{"111", "000000", ""},
+		{"2g", "61", ""},
+		{"112g", "000061", ""},
+		{"0", "", `invalid base58 character '0' at position 0`},
+		{"2gO", "", `invalid base58 character 'O' at position 2`},
+		{"1I", "", `invalid base58 character 'I' at position 1`},
+		{"l", "", `invalid base58 character 'l' at position 0`},
+		{"2g+", "", `invalid base58 character '+' at position 2`},
+	}
+	for _, tt := range tests {
+		got, err := Base58Decode([]byte(tt.input))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Base58Decode(%q): got error %v, want %q", tt.input, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || hex.EncodeToString(got) != tt.want {
+			t.Errorf("Base58Decode(%q) = %x, %v, want %s", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestBase58RoundTrip(t *testing.T) {
+	for _, input := range [][]byte{{}, {0}, {0, 0, 1}, {0, 0xff, 0}, []byte("hello world")} {
+		got, err := Base58Decode(Base58Encode(input))
+		if err != nil || !bytes.Equal(got, input) {
+			t.Errorf("round trip of %x gave %x, %v", input, got, err)
+		}
+	}
+}
+
+func TestBase58CheckDecode(t *testing.T) {
+	payload, _ := hex.DecodeString("77bff20c60e522dfaa3350c39b030a5d004e839a")
+	address := "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"
+	if got := string(Base58CheckEncode(0, payload)); got != address {
+		t.Fatalf("Base58CheckEncode = %s, want %s", got, address)
+	}
+	// Changing the last character corrupts the checksum.
+	corrupted := address[:len(address)-1] + "3"
+
+	tests := []struct {
+		name    string
+		input   string
+		version byte
+		payload []byte
+		err     string
+	}{
+		{"Valid", address, 0, payload, ""},
+		{"VersionOnly", string(Base58CheckEncode(5, nil)), 5, []byte{}, ""},
+		{"Empty", "", 0, nil, "too short"},
+		{"LeadingOnes", "11111", 0, nil, "checksum mismatch"},
+		{"TooShort", "1111", 0, nil, "data is 4 bytes, too short"},
+		{"InvalidCharacter", "0" + address[1:], 0, nil, "invalid base58 character"},
+		{"WrongChecksum", corrupted, 0, nil, "checksum mismatch"},
+		{"Truncated", address[:len(address)-2], 0, nil, "checksum mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, got, err := Base58CheckDecode([]byte(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				if tt.err == "checksum mismatch" && !errors.Is(err, ErrChecksum) {
+					t.Errorf("error %v is not ErrChecksum", err)
+				}
+				return
+			}
+			if err != nil || version != tt.version || !bytes.Equal(got, tt.payload) {
+				t.Errorf("got %d, %x, %v, want %d, %x", version, got, err, tt.version, tt.payload)
+			}
+		})
+	}
+}
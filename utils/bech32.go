@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Bech32 and bech32m (BIP 173 and BIP 350) encode 5-bit groups under a
+// human-readable prefix. They differ only in the constant the checksum is
+// XORed with.
+
+// Bech32Variant selects which checksum constant is used.
+type Bech32Variant int
+
+const (
+	Bech32 Bech32Variant = iota + 1
+	Bech32m
+)
+
+const (
+	bech32Charset  = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32Const    = 1
+	bech32mConst   = 0x2bc830a3
+	bech32MaxLen   = 90
+	bech32Checksum = 6
+)
+
+func (v Bech32Variant) constant() uint32 {
+	if v == Bech32m {
+		return bech32mConst
+	}
+	return bech32Const
+}
+
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32CreateChecksum(hrp string, data []byte, variant Bech32Variant) []byte {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, make([]byte, bech32Checksum)...)
+	polymod := bech32Polymod(values) ^ variant.constant()
+	checksum := make([]byte, bech32Checksum)
+	for i := range checksum {
+		checksum[i] = byte(polymod>>(5*(5-i))) & 31
+	}
+	return checksum
+}
+
+// Bech32Encode encodes data, a slice of 5-bit groups, under hrp.
+func Bech32Encode(hrp string, data []byte, variant Bech32Variant) (string, error) {
+	if len(hrp) == 0 {
+		return "", errors.New("bech32 prefix is empty")
+	}
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", fmt.Errorf("invalid bech32 prefix character %q", hrp[i])
+		}
+	}
+	hrp = strings.ToLower(hrp)
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, d := range append(data, bech32CreateChecksum(hrp, data, variant)...) {
+		if d > 31 {
+			return "", fmt.Errorf("bech32 data value %d is not a 5-bit group", d)
+		}
+		sb.WriteByte(bech32Charset[d])
+	}
+	if sb.Len() > bech32MaxLen {
+		return "", fmt.Errorf("bech32 string is %d characters, more than %d", sb.Len(), bech32MaxLen)
+	}
+	return sb.String(), nil
+}
+
+// Bech32Decode splits s into its prefix and 5-bit data groups, verifies the
+// checksum and reports which variant it was made with.
+func Bech32Decode(s string) (string, []byte, Bech32Variant, error) {
+	if len(s) > bech32MaxLen {
+		return "", nil, 0, fmt.Errorf("bech32 string is %d characters, more than %d", len(s), bech32MaxLen)
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, 0, errors.New("bech32 string mixes upper and lower case")
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+bech32Checksum+1 > len(s) {
+		return "", nil, 0, errors.New("bech32 string has no prefix or is too short")
+	}
+	hrp := s[:sep]
+	for i := 0; i < len(hrp); i++ {
+		if hrp[i] < 33 || hrp[i] > 126 {
+			return "", nil, 0, fmt.Errorf("invalid bech32 prefix character %q", hrp[i])
+		}
+	}
+
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		d := strings.IndexByte(bech32Charset, s[i])
+		if d < 0 {
+			return "", nil, 0, fmt.Errorf("invalid bech32 character %q at position %d", s[i], i)
+		}
+		data = append(data, byte(d))
+	}
+
+	var variant Bech32Variant
+	switch bech32Polymod(append(bech32HRPExpand(hrp), data...)) {
+	case bech32Const:
+		variant = Bech32
+	case bech32mConst:
+		variant = Bech32m
+	default:
+		return "", nil, 0, ErrChecksum
+	}
+	return hrp, data[:len(data)-bech32Checksum], variant, nil
+}
+
+// ConvertBits regroups data from fromBits-bit to toBits-bit groups. When
+// decoding, pad must be false and any leftover bits must be zero.
+func ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<toBits - 1
+	var out []byte
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, fmt.Errorf("value %d does not fit in %d bits", v, fromBits)
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
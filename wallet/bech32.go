@@ -0,0 +1,73 @@
+package wallet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Triad-0112/BlockChain.git/utils"
+)
+
+// Bech32 addresses follow the segwit address layout of BIP 173: a witness
+// version followed by a program, here the 20-byte public key hash. Only
+// version 0 exists, which BIP 350 keeps on the original bech32 checksum;
+// later versions would use bech32m.
+const bech32WitnessVersion = 0
+
+// EncodeBech32Address returns the bech32 address under hrp locking to
+// pubKeyHash.
+func EncodeBech32Address(hrp string, pubKeyHash []byte) (string, error) {
+	program, err := utils.ConvertBits(pubKeyHash, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+	data := append([]byte{bech32WitnessVersion}, program...)
+	return utils.Bech32Encode(hrp, data, utils.Bech32)
+}
+
+// decodeBech32Address returns the prefix and public key hash of a bech32
+// address.
+func decodeBech32Address(address string) (string, []byte, error) {
+	hrp, data, variant, err := utils.Bech32Decode(address)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(data) == 0 {
+		return "", nil, fmt.Errorf("no witness version")
+	}
+	if data[0] != bech32WitnessVersion {
+		return "", nil, fmt.Errorf("unsupported witness version %d", data[0])
+	}
+	if variant != utils.Bech32 {
+		return "", nil, fmt.Errorf("witness version %d must use bech32, not bech32m", data[0])
+	}
+	pubKeyHash, err := utils.ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(pubKeyHash) != pubKeyHashLen {
+		return "", nil, fmt.Errorf("hash is %d bytes, expected %d", len(pubKeyHash), pubKeyHashLen)
+	}
+	return hrp, pubKeyHash, nil
+}
+
+// isBech32 reports whether address looks like a bech32 string rather than
+// Base58Check, which starts with '1' for version 0 addresses.
+func isBech32(address string) bool {
+	return strings.LastIndexByte(address, '1') > 0
+}
+
+// CreateBech32Wallet is like CreateWallet but the new wallet's address is
+// bech32 encoded under hrp.
+func (ws *Wallets) CreateBech32Wallet(hrp string) (string, error) {
+	wallet, err := NewWallet()
+	if err != nil {
+		return "", err
+	}
+	if _, err := EncodeBech32Address(hrp, wallet.PubKeyHash()); err != nil {
+		return "", err
+	}
+	wallet.Bech32HRP = hrp
+	address := string(wallet.GetAddress())
+	ws.Wallets[address] = wallet
+	return address, nil
+}
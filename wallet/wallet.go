@@ -1,75 +1,158 @@
 package wallet
 
 import (
-	"bytes"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
-	"log"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 
 	"github.com/Triad-0112/BlockChain.git/utils"
 	"golang.org/x/crypto/ripemd160"
 )
 
 const (
-	version            = byte(0x00)
-	addressChecksumLen = 4
+	version = byte(0x00)
+	// pubKeyHashLen is the length of a RIPEMD-160 public key hash.
+	pubKeyHashLen = 20
 )
 
+// ErrInvalidAddress is returned for addresses that fail to decode or whose
+// checksum does not match.
+var ErrInvalidAddress = errors.New("invalid address")
+
 type Wallet struct {
 	PrivateKey ecdsa.PrivateKey
 	PublicKey  []byte
+	// WatchOnly wallets have no private key and can't spend. Those imported
+	// from an address have no public key either, only the hash it locks to.
+	WatchOnly bool
+	// Internal wallets hold change. Owner is the address whose spends
+	// created them; their funds count towards that address's balance.
+	Internal bool
+	Owner    string
+	// Label is a free-form note; Account groups addresses whose funds are
+	// reported and spent together. Change addresses join their owner's
+	// account.
+	Label   string
+	Account string
+	// Bech32HRP, when set, makes the wallet's address bech32 encoded under
+	// that prefix instead of Base58Check.
+	Bech32HRP  string
+	pubKeyHash []byte
 }
 
-func NewWallet() *Wallet {
-	private, public := newKeyPair()
-	wallet := Wallet{private, public}
-	return &wallet
+func NewWallet() (*Wallet, error) {
+	private, public, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	wallet := Wallet{PrivateKey: private, PublicKey: public}
+	return &wallet, nil
 }
 
 func (w *Wallet) GetAddress() []byte {
-	pubKeyHash := HashPubKey(w.PublicKey)
-	versionedPayload := append([]byte{version}, pubKeyHash...)
-	checksum := checksum(versionedPayload)
-	fullPayload := append(versionedPayload, checksum...)
-	address := utils.Base58Encode(fullPayload)
+	if w.Bech32HRP != "" {
+		// The prefix is checked when the wallet is created, so encoding
+		// can't fail.
+		address, _ := EncodeBech32Address(w.Bech32HRP, w.PubKeyHash())
+		return []byte(address)
+	}
+	return []byte(PubKeyHashToAddress(w.PubKeyHash()))
+}
 
-	return address
+// PubKeyHash returns the hash outputs paying this wallet are locked to.
+func (w *Wallet) PubKeyHash() []byte {
+	if len(w.PublicKey) == 0 {
+		return w.pubKeyHash
+	}
+	return HashPubKey(w.PublicKey)
+}
+
+// PubKeyHashToAddress returns the Base58Check address locking to pubKeyHash.
+func PubKeyHashToAddress(pubKeyHash []byte) string {
+	return string(utils.Base58CheckEncode(version, pubKeyHash))
 }
 
 func HashPubKey(pubKey []byte) []byte {
 	publicSHA256 := sha256.Sum256(pubKey)
 	RIPEMD160Hasher := ripemd160.New()
-	_, err := RIPEMD160Hasher.Write(publicSHA256[:])
-	if err != nil {
-		log.Panic(err)
-	}
+	// Writing to a hash never fails.
+	_, _ = RIPEMD160Hasher.Write(publicSHA256[:])
 	publicRIPEMD160 := RIPEMD160Hasher.Sum(nil)
 	return publicRIPEMD160
 }
 
-func ValidateAddress(address string) bool {
-	pubKeyHash := utils.Base58Decode([]byte(address))
-	actualChecksum := pubKeyHash[len(pubKeyHash)-addressChecksumLen:]
-	version := pubKeyHash[0]
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-addressChecksumLen]
-	targetChecksum := checksum(append([]byte{version}, pubKeyHash...))
-	return bytes.Equal(actualChecksum, targetChecksum)
+// AddressToPubKeyHash returns the public key hash an address locks to. Both
+// Base58Check addresses and bech32 addresses under hrp, the prefix of the
+// network, are accepted, and the two forms of the same key resolve to the
+// same hash. It fails with ErrInvalidAddress if address is malformed, has a
+// bad checksum or belongs to another address version or network.
+func AddressToPubKeyHash(address, hrp string) ([]byte, error) {
+	addressVersion, pubKeyHash, err := utils.Base58CheckDecode([]byte(address))
+	if err != nil && isBech32(address) {
+		var addressHRP string
+		addressHRP, pubKeyHash, err = decodeBech32Address(address)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %w", ErrInvalidAddress, address, err)
+		}
+		if !strings.EqualFold(addressHRP, hrp) {
+			return nil, fmt.Errorf("%w %q: prefix %q, expected %q", ErrInvalidAddress, address, addressHRP, hrp)
+		}
+		return pubKeyHash, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %w", ErrInvalidAddress, address, err)
+	}
+	if addressVersion != version {
+		return nil, fmt.Errorf("%w %q: version %#x, expected %#x", ErrInvalidAddress, address, addressVersion, version)
+	}
+	if len(pubKeyHash) != pubKeyHashLen {
+		return nil, fmt.Errorf("%w %q: hash is %d bytes, expected %d", ErrInvalidAddress, address, len(pubKeyHash), pubKeyHashLen)
+	}
+	return pubKeyHash, nil
+}
+
+// ValidateAddress reports whether AddressToPubKeyHash accepts address.
+func ValidateAddress(address, hrp string) bool {
+	_, err := AddressToPubKeyHash(address, hrp)
+	return err == nil
+}
+
+// splitPubKey returns the coordinates of a public key in the X||Y form
+// produced by newKeyPair.
+func splitPubKey(pubKey []byte) (*big.Int, *big.Int) {
+	half := len(pubKey) / 2
+	x := new(big.Int).SetBytes(pubKey[:half])
+	y := new(big.Int).SetBytes(pubKey[half:])
+	return x, y
+}
+
+// ValidatePubKey reports whether pubKey is a point on the wallet curve in the
+// X||Y form produced by newKeyPair.
+func ValidatePubKey(pubKey []byte) bool {
+	if len(pubKey) != 64 {
+		return false
+	}
+	x, y := splitPubKey(pubKey)
+	return elliptic.P256().IsOnCurve(x, y)
 }
 
-func checksum(payload []byte) []byte {
-	firstSHA := sha256.Sum256(payload)
-	secondSHA := sha256.Sum256(firstSHA[:])
-	return secondSHA[:addressChecksumLen]
+// PublicKeyFromBytes parses a public key in the X||Y form stored in inputs.
+func PublicKeyFromBytes(pubKey []byte) ecdsa.PublicKey {
+	x, y := splitPubKey(pubKey)
+	return ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
 }
 
-func newKeyPair() (ecdsa.PrivateKey, []byte) {
+func newKeyPair() (ecdsa.PrivateKey, []byte, error) {
 	curve := elliptic.P256()
 	private, err := ecdsa.GenerateKey(curve, rand.Reader)
 	if err != nil {
-		log.Panic(err)
+		return ecdsa.PrivateKey{}, nil, err
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
-	return *private, pubKey
+	pubKey := append(private.PublicKey.X.FillBytes(make([]byte, 32)), private.PublicKey.Y.FillBytes(make([]byte, 32))...)
+	return *private, pubKey, nil
 }
@@ -0,0 +1,31 @@
+package wallet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestAddressToPubKeyHashChecksPrefix(t *testing.T) {
+	w, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hrp := range []string{"gc", "gcrt", "bc", "tb"} {
+		address, err := EncodeBech32Address(hrp, w.PubKeyHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubKeyHash, err := AddressToPubKeyHash(address, "gcrt")
+		if hrp == "gcrt" {
+			if err != nil || !bytes.Equal(pubKeyHash, w.PubKeyHash()) {
+				t.Errorf("%s: got %x, %v, want %x", address, pubKeyHash, err, w.PubKeyHash())
+			}
+		} else if !errors.Is(err, ErrInvalidAddress) {
+			t.Errorf("%s: got %v, want ErrInvalidAddress", address, err)
+		}
+	}
+	if _, err := AddressToPubKeyHash(string(w.GetAddress()), "gcrt"); err != nil {
+		t.Errorf("Base58Check address: %v", err)
+	}
+}
@@ -4,43 +4,206 @@ import (
 	"bytes"
 	"crypto/elliptic"
 	"encoding/gob"
+	"fmt"
 	"io/ioutil"
-	"log"
 	"math/big"
 	"os"
+	"sort"
 )
 
 const walletFile = "wallets.dat"
 
 type Wallets struct {
 	Wallets map[string]*Wallet
+	file    string
 }
 
 type serializableWallet struct {
 	PrivateKey []byte
 	PublicKey  []byte
+	WatchOnly  bool
+	PubKeyHash []byte
+	Internal   bool
+	Owner      string
+	Label      string
+	Account    string
+	Bech32HRP  string
 }
 
 func NewWallets() (*Wallets, error) {
-	wallets := Wallets{}
+	return NewWalletsFromFile(walletFile)
+}
+
+// NewWalletsFromFile loads the wallets stored in path. Like NewWallets, it
+// returns a usable empty set along with the error if path does not exist yet.
+func NewWalletsFromFile(path string) (*Wallets, error) {
+	wallets := Wallets{file: path}
 	wallets.Wallets = make(map[string]*Wallet)
 
 	err := wallets.LoadFromFile()
 	return &wallets, err
 }
 
-func (ws *Wallets) CreateWallet() string {
-	wallet := NewWallet()
+func (ws *Wallets) CreateWallet() (string, error) {
+	wallet, err := NewWallet()
+	if err != nil {
+		return "", err
+	}
+	address := string(wallet.GetAddress())
+	ws.Wallets[address] = wallet
+	return address, nil
+}
+
+// NewChangeAddress creates an internal wallet to receive the change of a
+// payment from owner and returns its address. Change of change belongs to
+// the original owner.
+func (ws *Wallets) NewChangeAddress(owner string) (string, error) {
+	if w, ok := ws.Wallets[owner]; ok && w.Internal {
+		owner = w.Owner
+	}
+	wallet, err := NewWallet()
+	if err != nil {
+		return "", err
+	}
+	wallet.Internal = true
+	wallet.Owner = owner
+	if w, ok := ws.Wallets[owner]; ok {
+		wallet.Account = w.Account
+		wallet.Bech32HRP = w.Bech32HRP
+	}
+	address := string(wallet.GetAddress())
+	ws.Wallets[address] = wallet
+	return address, nil
+}
+
+// OwnedAddresses returns address followed by the change addresses it owns.
+func (ws *Wallets) OwnedAddresses(address string) []string {
+	addresses := []string{address}
+	for changeAddress, wallet := range ws.Wallets {
+		if wallet.Internal && wallet.Owner == address {
+			addresses = append(addresses, changeAddress)
+		}
+	}
+	return addresses
+}
+
+// ImportAddress adds a watch-only entry for address, so its balance and
+// history can be tracked without holding its key. A bech32 address must be
+// under hrp.
+func (ws *Wallets) ImportAddress(address, hrp string) error {
+	pubKeyHash, err := AddressToPubKeyHash(address, hrp)
+	if err != nil {
+		return err
+	}
+	if existingAddress, existing := ws.findByPubKeyHash(pubKeyHash); existing != nil {
+		return alreadyInWallet(address, existingAddress)
+	}
+	ws.Wallets[address] = &Wallet{WatchOnly: true, pubKeyHash: pubKeyHash}
+	return nil
+}
+
+// ImportPubKey adds a watch-only entry for the address of pubKey and returns
+// that address.
+func (ws *Wallets) ImportPubKey(pubKey []byte) (string, error) {
+	if !ValidatePubKey(pubKey) {
+		return "", fmt.Errorf("public key %x is not valid", pubKey)
+	}
+	return ws.addKey(&Wallet{PublicKey: pubKey, WatchOnly: true})
+}
+
+// addKey adds wallet under its address. An entry for the same key under
+// either address format is replaced, keeping its label and account, if it
+// knows less about the key: a watch-only entry without the public key, or
+// one without the private key when wallet has it. Otherwise addKey fails.
+func (ws *Wallets) addKey(wallet *Wallet) (string, error) {
 	address := string(wallet.GetAddress())
+	if existingAddress, existing := ws.findByPubKeyHash(wallet.PubKeyHash()); existing != nil {
+		if keyKnowledge(existing) >= keyKnowledge(wallet) {
+			return "", alreadyInWallet(address, existingAddress)
+		}
+		delete(ws.Wallets, existingAddress)
+		wallet.Label = existing.Label
+		wallet.Account = existing.Account
+	}
 	ws.Wallets[address] = wallet
-	return address
+	return address, nil
+}
+
+// keyKnowledge ranks wallets by what they know of their key: 2 for the
+// private key, 1 for only the public key and 0 for only its hash.
+func keyKnowledge(w *Wallet) int {
+	switch {
+	case !w.WatchOnly:
+		return 2
+	case len(w.PublicKey) != 0:
+		return 1
+	}
+	return 0
 }
 
+func alreadyInWallet(address, existingAddress string) error {
+	if address == existingAddress {
+		return fmt.Errorf("address %s is already in the wallet", address)
+	}
+	return fmt.Errorf("address %s is already in the wallet as %s", address, existingAddress)
+}
+
+// GetAddresses returns every address in the wallet, sorted.
 func (ws *Wallets) GetAddresses() []string {
 	var addresses []string
 	for address := range ws.Wallets {
 		addresses = append(addresses, address)
 	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// SetLabel attaches label to address.
+func (ws *Wallets) SetLabel(address, label string) error {
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return fmt.Errorf("address %s is not in the wallet", address)
+	}
+	wallet.Label = label
+	return nil
+}
+
+// SetAccount moves address, along with the change addresses it owns, into
+// account.
+func (ws *Wallets) SetAccount(address, account string) error {
+	if _, ok := ws.Wallets[address]; !ok {
+		return fmt.Errorf("address %s is not in the wallet", address)
+	}
+	for _, owned := range ws.OwnedAddresses(address) {
+		ws.Wallets[owned].Account = account
+	}
+	return nil
+}
+
+// Accounts returns the names of all accounts in use, sorted. Addresses that
+// were never assigned one belong to the unnamed default account "".
+func (ws *Wallets) Accounts() []string {
+	seen := make(map[string]bool)
+	var accounts []string
+	for _, wallet := range ws.Wallets {
+		if !seen[wallet.Account] {
+			seen[wallet.Account] = true
+			accounts = append(accounts, wallet.Account)
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// AccountAddresses returns the sorted addresses in account, including change
+// addresses.
+func (ws *Wallets) AccountAddresses(account string) []string {
+	var addresses []string
+	for _, address := range ws.GetAddresses() {
+		if ws.Wallets[address].Account == account {
+			addresses = append(addresses, address)
+		}
+	}
 	return addresses
 }
 
@@ -48,14 +211,35 @@ func (ws *Wallets) GetWallet(address string) Wallet {
 	return *ws.Wallets[address]
 }
 
+// FindByPubKeyHash returns the wallet whose public key hashes to pubKeyHash,
+// or nil if there is none. If there are several, as wallets written before
+// imports were checked across address formats may hold, the one knowing the
+// most about the key is returned.
+func (ws *Wallets) FindByPubKeyHash(pubKeyHash []byte) *Wallet {
+	_, wallet := ws.findByPubKeyHash(pubKeyHash)
+	return wallet
+}
+
+func (ws *Wallets) findByPubKeyHash(pubKeyHash []byte) (string, *Wallet) {
+	var found string
+	var best *Wallet
+	for _, address := range ws.GetAddresses() {
+		wallet := ws.Wallets[address]
+		if bytes.Equal(wallet.PubKeyHash(), pubKeyHash) && (best == nil || keyKnowledge(wallet) > keyKnowledge(best)) {
+			found, best = address, wallet
+		}
+	}
+	return found, best
+}
+
 func (ws *Wallets) LoadFromFile() error {
-	if _, err := os.Stat(walletFile); os.IsNotExist(err) {
+	if _, err := os.Stat(ws.file); os.IsNotExist(err) {
 		return err
 	}
 
-	fileContent, err := ioutil.ReadFile(walletFile)
+	fileContent, err := ioutil.ReadFile(ws.file)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
 	var serializableWallets map[string]serializableWallet
@@ -63,13 +247,21 @@ func (ws *Wallets) LoadFromFile() error {
 	decoder := gob.NewDecoder(bytes.NewReader(fileContent))
 	err = decoder.Decode(&serializableWallets)
 	if err != nil {
-		log.Panic(err)
+		return fmt.Errorf("decoding %s: %w", ws.file, err)
 	}
 
 	ws.Wallets = make(map[string]*Wallet)
 	for address, sWallet := range serializableWallets {
 		wallet := Wallet{}
 		wallet.PublicKey = sWallet.PublicKey
+		if sWallet.WatchOnly {
+			wallet.WatchOnly = true
+			wallet.pubKeyHash = sWallet.PubKeyHash
+			wallet.Label = sWallet.Label
+			wallet.Account = sWallet.Account
+			ws.Wallets[address] = &wallet
+			continue
+		}
 
 		curve := elliptic.P256()
 		privKey := new(big.Int)
@@ -77,6 +269,13 @@ func (ws *Wallets) LoadFromFile() error {
 
 		wallet.PrivateKey.D = privKey
 		wallet.PrivateKey.Curve = curve
+		wallet.PrivateKey.X, wallet.PrivateKey.Y = splitPubKey(sWallet.PublicKey)
+
+		wallet.Internal = sWallet.Internal
+		wallet.Owner = sWallet.Owner
+		wallet.Label = sWallet.Label
+		wallet.Account = sWallet.Account
+		wallet.Bech32HRP = sWallet.Bech32HRP
 
 		ws.Wallets[address] = &wallet
 	}
@@ -84,14 +283,29 @@ func (ws *Wallets) LoadFromFile() error {
 	return nil
 }
 
-func (ws *Wallets) SaveToFile() {
+func (ws *Wallets) SaveToFile() error {
 	var content bytes.Buffer
 
 	serializableWallets := make(map[string]serializableWallet)
 	for address, wallet := range ws.Wallets {
+		if wallet.WatchOnly {
+			serializableWallets[address] = serializableWallet{
+				PublicKey:  wallet.PublicKey,
+				WatchOnly:  true,
+				PubKeyHash: wallet.PubKeyHash(),
+				Label:      wallet.Label,
+				Account:    wallet.Account,
+			}
+			continue
+		}
 		serializableWallets[address] = serializableWallet{
 			PrivateKey: wallet.PrivateKey.D.Bytes(),
 			PublicKey:  wallet.PublicKey,
+			Internal:   wallet.Internal,
+			Owner:      wallet.Owner,
+			Label:      wallet.Label,
+			Account:    wallet.Account,
+			Bech32HRP:  wallet.Bech32HRP,
 		}
 	}
 
@@ -100,11 +314,8 @@ func (ws *Wallets) SaveToFile() {
 	encoder := gob.NewEncoder(&content)
 	err := encoder.Encode(serializableWallets)
 	if err != nil {
-		log.Panic(err)
+		return err
 	}
 
-	err = ioutil.WriteFile(walletFile, content.Bytes(), 0644)
-	if err != nil {
-		log.Panic(err)
-	}
+	return ioutil.WriteFile(ws.file, content.Bytes(), 0644)
 }
@@ -0,0 +1,98 @@
+package wallet
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func newTestWallets(t *testing.T) *Wallets {
+	t.Helper()
+	ws, _ := NewWalletsFromFile(filepath.Join(t.TempDir(), "wallets.dat"))
+	return ws
+}
+
+func TestImportOtherFormatOfHeldKey(t *testing.T) {
+	ws := newTestWallets(t)
+	address, err := ws.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := ws.Wallets[address]
+	bech32Address, err := EncodeBech32Address("gc", w.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.ImportAddress(bech32Address, "gc"); err == nil {
+		t.Error("ImportAddress accepted the bech32 form of a held key")
+	}
+	if _, err := ws.ImportPubKey(w.PublicKey); err == nil {
+		t.Error("ImportPubKey accepted a held key")
+	}
+	if n := len(ws.Wallets); n != 1 {
+		t.Errorf("wallet has %d entries, want 1", n)
+	}
+}
+
+func TestImportWIFReplacesWatchOnly(t *testing.T) {
+	key, err := NewWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wif, err := key.ExportWIF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bech32Address, err := EncodeBech32Address("gc", key.PubKeyHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ws := newTestWallets(t)
+	if err := ws.ImportAddress(bech32Address, "gc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SetLabel(bech32Address, "savings"); err != nil {
+		t.Fatal(err)
+	}
+	address, err := ws.ImportWIF(wif)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(ws.Wallets); n != 1 {
+		t.Fatalf("wallet has %d entries, want 1", n)
+	}
+	w := ws.FindByPubKeyHash(key.PubKeyHash())
+	if w == nil || w.WatchOnly {
+		t.Fatalf("FindByPubKeyHash returned %+v, want the imported key", w)
+	}
+	if w.Label != "savings" {
+		t.Errorf("label = %q, want it kept from the watch-only entry", w.Label)
+	}
+	if _, err := ws.ImportWIF(wif); err == nil {
+		t.Errorf("importing %s twice succeeded", address)
+	}
+}
+
+func TestFindByPubKeyHashPrefersKey(t *testing.T) {
+	ws := newTestWallets(t)
+	address, err := ws.CreateWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := ws.Wallets[address]
+	// Wallet files written before imports were checked across formats can
+	// hold a watch-only duplicate of a key.
+	for _, hrp := range []string{"a", "gc", "zz"} {
+		duplicate, err := EncodeBech32Address(hrp, w.PubKeyHash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		ws.Wallets[duplicate] = &Wallet{WatchOnly: true, pubKeyHash: w.PubKeyHash()}
+	}
+	for i := 0; i < 10; i++ {
+		if got := ws.FindByPubKeyHash(w.PubKeyHash()); got != w {
+			t.Fatalf("FindByPubKeyHash returned %+v, want the wallet holding the key", got)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/Triad-0112/BlockChain.git/utils"
+)
+
+// wifVersion prefixes private keys in wallet import format, the same way
+// version prefixes addresses.
+const (
+	wifVersion = byte(0x80)
+	privKeyLen = 32
+)
+
+// ExportWIF returns the wallet's private key in wallet import format: the
+// Base58Check encoding of the 32-byte private key under wifVersion.
+func (w *Wallet) ExportWIF() (string, error) {
+	if w.WatchOnly {
+		return "", errors.New("watch-only wallets have no private key")
+	}
+	return string(utils.Base58CheckEncode(wifVersion, w.PrivateKey.D.FillBytes(make([]byte, privKeyLen)))), nil
+}
+
+// DecodeWIF parses a private key in wallet import format and rebuilds the
+// wallet holding it.
+func DecodeWIF(wif string) (*Wallet, error) {
+	keyVersion, key, err := utils.Base58CheckDecode([]byte(wif))
+	if err != nil {
+		return nil, fmt.Errorf("decoding WIF key: %w", err)
+	}
+	if keyVersion != wifVersion {
+		return nil, fmt.Errorf("WIF key has version %#x, expected %#x", keyVersion, wifVersion)
+	}
+	if len(key) != privKeyLen {
+		return nil, fmt.Errorf("WIF key has %d bytes, expected %d", len(key), privKeyLen)
+	}
+
+	curve := elliptic.P256()
+	d := new(big.Int).SetBytes(key)
+	if d.Sign() == 0 || d.Cmp(curve.Params().N) >= 0 {
+		return nil, errors.New("WIF key is out of range")
+	}
+	private := ecdsa.PrivateKey{D: d}
+	private.Curve = curve
+	private.X, private.Y = curve.ScalarBaseMult(key)
+
+	pubKey := append(private.X.FillBytes(make([]byte, 32)), private.Y.FillBytes(make([]byte, 32))...)
+	return &Wallet{PrivateKey: private, PublicKey: pubKey}, nil
+}
+
+// ImportWIF adds the key in wif to the wallet set, replacing any watch-only
+// entry for the same key, and returns the address.
+func (ws *Wallets) ImportWIF(wif string) (string, error) {
+	wallet, err := DecodeWIF(wif)
+	if err != nil {
+		return "", err
+	}
+	return ws.addKey(wallet)
+}